@@ -0,0 +1,178 @@
+package authy
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+// Where an Account came from
+const (
+	SourceToken  = "token"
+	SourceApp    = "app"
+	SourceImport = "import"
+)
+
+// Account is an authenticator token, an Authy App, or a key imported from
+// another app, in a common form, so that exporting and generating codes
+// doesn't depend on where it came from.
+type Account struct {
+	// SourceToken, SourceApp or SourceImport
+	Source string
+
+	// The UniqueID of a token, or the ID of an app. Imported keys have none.
+	ID string
+
+	// The name in Authy, or the label of an imported key
+	Name string
+
+	// The AccountType of a token, or the AssetsGroup of an app
+	AccountType string
+
+	// Inferred issuer and account label
+	Identity
+
+	// The base32-encoded secret, normalized by NormalizeSecret
+	Secret string
+
+	Digits int
+
+	// The period, in seconds: 30 for tokens, and 10 for Authy Apps
+	Period int
+
+	// SHA1, SHA256 or SHA512
+	Algorithm string
+
+	// Labels for grouping
+	Tags []string
+
+	// Whether it was recently deleted from Authy
+	Deleted bool
+}
+
+// NewTokenAccount returns the Account of a token, decrypted by passphrase,
+// with its secret normalized. If it can't be decrypted, or its secret isn't
+// valid, the Account is returned without a Secret, along with the error,
+// which is an InvalidSecretError in the latter case.
+func NewTokenAccount(tok AuthenticatorToken, passphrase string, issuers IssuerTable) (Account, error) {
+	a := Account{
+		Source:      SourceToken,
+		ID:          tok.UniqueID,
+		Name:        tok.Description(),
+		AccountType: tok.AccountType,
+		Identity:    issuers.Token(tok),
+		Digits:      tok.Digits,
+		Period:      30,
+		Algorithm:   "SHA1",
+	}
+	secret, err := tok.Decrypt(passphrase)
+	if err != nil {
+		return a, err
+	}
+	a.Secret, err = NormalizeSecret(secret)
+	return a, err
+}
+
+// NewAppAccount returns the Account of an Authy App. If its seed can't be
+// decoded, the Account is returned without a Secret, along with the error.
+func NewAppAccount(app AuthenticatorApp, issuers IssuerTable) (Account, error) {
+	a := Account{
+		Source:      SourceApp,
+		ID:          app.ID,
+		Name:        app.Name,
+		AccountType: app.AssetsGroup,
+		Identity:    issuers.App(app),
+		Digits:      app.Digits,
+		Period:      totpTimeStep,
+		Algorithm:   "SHA1",
+	}
+	secret, err := app.Token()
+	if err != nil {
+		return a, err
+	}
+	a.Secret, err = NormalizeSecret(secret)
+	return a, err
+}
+
+// NewImportedAccount returns the Account of a key imported from another
+// app. Only TOTP keys are supported.
+func NewImportedAccount(k otpauth.Key) (Account, error) {
+	a := Account{
+		Source:    SourceImport,
+		Name:      k.Label(),
+		Identity:  Identity{Issuer: k.Issuer, Account: k.Account},
+		Digits:    k.Digits,
+		Period:    k.Period,
+		Algorithm: k.Algorithm,
+		Tags:      k.Tags,
+	}
+	if k.Type != otpauth.TypeTOTP {
+		return a, fmt.Errorf("%s keys aren't supported", k.Type)
+	}
+	var err error
+	a.Secret, err = NormalizeSecret(k.Secret)
+	return a, err
+}
+
+// SecretBytes returns the raw bytes of the secret.
+func (a Account) SecretBytes() ([]byte, error) {
+	return DecodeSecret(a.Secret)
+}
+
+// Weakness returns why the secret is suspicious, as by SecretWeakness, or an
+// empty string if it isn't or there is no secret.
+func (a Account) Weakness() string {
+	secret, err := a.SecretBytes()
+	if err != nil {
+		return ""
+	}
+	return SecretWeakness(secret)
+}
+
+// Key returns the account as a TOTP key.
+func (a Account) Key() otpauth.Key {
+	return otpauth.Key{
+		Type:      otpauth.TypeTOTP,
+		Issuer:    a.Issuer,
+		Account:   a.Account,
+		Secret:    a.Secret,
+		Algorithm: a.Algorithm,
+		Digits:    a.Digits,
+		Period:    a.Period,
+		Tags:      a.Tags,
+	}
+}
+
+// URI returns the account in Key URI format (otpauth://).
+func (a Account) URI() string {
+	return a.Key().URI()
+}
+
+var hashes = map[string]func() hash.Hash{
+	"":       sha1.New,
+	"SHA1":   sha1.New,
+	"SHA256": sha256.New,
+	"SHA512": sha512.New,
+}
+
+// Code returns the TOTP code of the account at time t.
+func (a Account) Code(t time.Time) (string, error) {
+	newHash, ok := hashes[a.Algorithm]
+	if !ok {
+		return "", fmt.Errorf("Unsupported algorithm %s", a.Algorithm)
+	}
+	if a.Period <= 0 || a.Digits <= 0 {
+		return "", errors.New("The account has no period or number of digits")
+	}
+	secret, err := a.SecretBytes()
+	if err != nil {
+		return "", err
+	}
+	return generateTOTP(newHash, secret, t, a.Digits, int64(a.Period))
+}
@@ -0,0 +1,215 @@
+// Package aegis reads vaults exported by the Aegis Authenticator, plain or
+// encrypted with a password.
+package aegis
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/alexzorin/authy/otpauth"
+	"golang.org/x/crypto/scrypt"
+)
+
+// vault is an exported vault. Its db is an object if it is plain, or a
+// base64 string if it is encrypted.
+type vault struct {
+	Version int             `json:"version"`
+	Header  header          `json:"header"`
+	DB      json.RawMessage `json:"db"`
+}
+
+type header struct {
+	Slots  []slot     `json:"slots"`
+	Params *keyParams `json:"params"`
+}
+
+// slot holds the master key, encrypted with a key derived from a password
+// (for password slots).
+type slot struct {
+	Type      int       `json:"type"`
+	Key       string    `json:"key"`
+	KeyParams keyParams `json:"key_params"`
+	N         int       `json:"n"`
+	R         int       `json:"r"`
+	P         int       `json:"p"`
+	Salt      string    `json:"salt"`
+}
+
+type keyParams struct {
+	Nonce string `json:"nonce"`
+	Tag   string `json:"tag"`
+}
+
+const slotPassword = 1
+
+type db struct {
+	Version int     `json:"version"`
+	Entries []entry `json:"entries"`
+	Groups  []group `json:"groups"`
+}
+
+type entry struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Issuer string `json:"issuer"`
+
+	// The group name, in versions before 3
+	Group string `json:"group"`
+
+	// The UUIDs of the entry's groups, from version 3
+	Groups []string `json:"groups"`
+
+	Info struct {
+		Secret  string `json:"secret"`
+		Algo    string `json:"algo"`
+		Digits  int    `json:"digits"`
+		Period  int    `json:"period"`
+		Counter uint64 `json:"counter"`
+	} `json:"info"`
+}
+
+type group struct {
+	UUID string `json:"uuid"`
+	Name string `json:"name"`
+}
+
+// Read reads the keys of an exported vault. The password is only needed
+// if the vault is encrypted. Entries of unsupported types are left out, and
+// reported with an otpauth.UnsupportedError.
+func Read(r io.Reader, password string) ([]otpauth.Key, error) {
+	var v vault
+	if err := json.NewDecoder(r).Decode(&v); err != nil {
+		return nil, fmt.Errorf("Failed to decode the vault: %v", err)
+	}
+
+	plain := []byte(v.DB)
+	if v.Header.Params != nil {
+		if password == "" {
+			return nil, otpauth.ErrPasswordRequired
+		}
+		var err error
+		if plain, err = v.decrypt(password); err != nil {
+			return nil, err
+		}
+	}
+
+	var d db
+	if err := json.Unmarshal(plain, &d); err != nil {
+		return nil, fmt.Errorf("Failed to decode the vault's entries: %v", err)
+	}
+	groups := map[string]string{}
+	for _, g := range d.Groups {
+		groups[g.UUID] = g.Name
+	}
+
+	var keys []otpauth.Key
+	var skipped []string
+	for _, e := range d.Entries {
+		k := otpauth.New(e.Issuer, e.Name, e.Info.Secret)
+		switch e.Type {
+		case "totp":
+		case "hotp":
+			k.Type = otpauth.TypeHOTP
+			k.Counter = e.Info.Counter
+		case "steam":
+			k.Type = otpauth.TypeSteam
+		default:
+			skipped = append(skipped, fmt.Sprintf("%s (%s key)", k.Label(), e.Type))
+			continue
+		}
+		if e.Info.Algo != "" {
+			k.Algorithm = strings.ToUpper(e.Info.Algo)
+		}
+		if e.Info.Digits != 0 {
+			k.Digits = e.Info.Digits
+		}
+		if e.Info.Period != 0 {
+			k.Period = e.Info.Period
+		}
+		if e.Group != "" {
+			k.Tags = append(k.Tags, e.Group)
+		}
+		for _, id := range e.Groups {
+			if name, ok := groups[id]; ok {
+				k.Tags = append(k.Tags, name)
+			}
+		}
+		keys = append(keys, k)
+	}
+	if len(skipped) > 0 {
+		return keys, &otpauth.UnsupportedError{Skipped: skipped}
+	}
+	return keys, nil
+}
+
+// decrypt decrypts the vault's db with the master key, from the first
+// password slot that the password opens.
+func (v vault) decrypt(password string) ([]byte, error) {
+	var masterKey []byte
+	for _, s := range v.Header.Slots {
+		if s.Type != slotPassword {
+			continue
+		}
+		salt, err := hex.DecodeString(s.Salt)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid slot salt: %v", err)
+		}
+		key, err := scrypt.Key([]byte(password), salt, s.N, s.R, s.P, 32)
+		if err != nil {
+			return nil, err
+		}
+		encrypted, err := hex.DecodeString(s.Key)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid slot key: %v", err)
+		}
+		if masterKey, err = openGCM(key, encrypted, s.KeyParams); err == nil {
+			break
+		}
+	}
+	if masterKey == nil {
+		return nil, errors.New("The password doesn't decrypt the vault")
+	}
+
+	var encoded string
+	if err := json.Unmarshal(v.DB, &encoded); err != nil {
+		return nil, fmt.Errorf("Failed to decode the encrypted vault: %v", err)
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode the encrypted vault: %v", err)
+	}
+	plain, err := openGCM(masterKey, encrypted, *v.Header.Params)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decrypt the vault: %v", err)
+	}
+	return plain, nil
+}
+
+// openGCM decrypts ciphertext with AES-GCM, with the nonce and tag from
+// params.
+func openGCM(key, ciphertext []byte, params keyParams) ([]byte, error) {
+	nonce, err := hex.DecodeString(params.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := hex.DecodeString(params.Tag)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, nonce, append(append([]byte{}, ciphertext...), tag...), nil)
+}
@@ -0,0 +1,60 @@
+package aegis
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+func readVault(t *testing.T, path, password string) ([]otpauth.Key, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	return Read(f, password)
+}
+
+// checkKeys checks the keys read from the test vaults, which have the same
+// entries. The Yandex entry is left out and reported.
+func checkKeys(t *testing.T, keys []otpauth.Key, err error) {
+	t.Helper()
+	uerr, ok := err.(*otpauth.UnsupportedError)
+	if !ok || len(uerr.Skipped) != 1 || !strings.Contains(uerr.Skipped[0], "Yandex:dave (yandex key)") {
+		t.Errorf("Expected the Yandex entry to be skipped, got %v", err)
+	}
+	expected := []struct {
+		uri  string
+		tags string
+	}{
+		{"otpauth://totp/GitHub:alice?digits=6&issuer=GitHub&secret=JBSWY3DPEHPK3PXP", "Work"},
+		{"otpauth://hotp/Google:bob@example.com?counter=7&digits=6&issuer=Google&secret=GEZDGNBVGY3TQOJQ", ""},
+		{"otpauth://steam/Steam:carol?digits=5&issuer=Steam&secret=KRUGKIDROVUWG2ZA", ""},
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Got %d keys, expected %d", len(keys), len(expected))
+	}
+	for i, k := range keys {
+		if k.URI() != expected[i].uri || strings.Join(k.Tags, ",") != expected[i].tags {
+			t.Errorf("Key %d: got %s tagged %v, expected %s tagged %q", i, k.URI(), k.Tags, expected[i].uri, expected[i].tags)
+		}
+	}
+}
+
+func TestReadPlain(t *testing.T) {
+	keys, err := readVault(t, "testdata/plain.json", "")
+	checkKeys(t, keys, err)
+}
+
+func TestReadEncrypted(t *testing.T) {
+	if _, err := readVault(t, "testdata/encrypted.json", ""); err != otpauth.ErrPasswordRequired {
+		t.Errorf("Expected a password to be required, got %v", err)
+	}
+	if _, err := readVault(t, "testdata/encrypted.json", "wrong"); err == nil || !strings.Contains(err.Error(), "password") {
+		t.Errorf("Expected the wrong password to be rejected, got %v", err)
+	}
+	keys, err := readVault(t, "testdata/encrypted.json", "test")
+	checkKeys(t, keys, err)
+}
@@ -0,0 +1,144 @@
+// Package andotp reads backups of andOTP, plain (.json) or encrypted with a
+// password (.json.aes).
+package andotp
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/alexzorin/authy/otpauth"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+type entry struct {
+	Secret    string   `json:"secret"`
+	Issuer    string   `json:"issuer"`
+	Label     string   `json:"label"`
+	Digits    int      `json:"digits"`
+	Type      string   `json:"type"`
+	Algorithm string   `json:"algorithm"`
+	Period    int      `json:"period"`
+	Counter   uint64   `json:"counter"`
+	Tags      []string `json:"tags"`
+}
+
+// Read reads the keys of a backup. The password is only needed if the backup
+// is encrypted. Entries of unsupported types are left out, and reported with
+// an otpauth.UnsupportedError.
+func Read(r io.Reader, password string) ([]otpauth.Key, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Plain backups are a JSON array
+	if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '[' {
+		if password == "" {
+			return nil, otpauth.ErrPasswordRequired
+		}
+		if data, err = decrypt(data, password); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("Failed to decode the backup: %v", err)
+	}
+
+	var keys []otpauth.Key
+	var skipped []string
+	for _, e := range entries {
+		issuer, account := e.Issuer, e.Label
+		// Older backups have only a label, "Issuer - account"
+		if issuer == "" {
+			if i := strings.Index(account, " - "); i > 0 {
+				issuer, account = account[:i], account[i+3:]
+			}
+		}
+		k := otpauth.New(issuer, account, e.Secret)
+		switch strings.ToUpper(e.Type) {
+		case "", "TOTP":
+		case "HOTP":
+			k.Type = otpauth.TypeHOTP
+			k.Counter = e.Counter
+		case "STEAM":
+			k.Type = otpauth.TypeSteam
+		default:
+			skipped = append(skipped, fmt.Sprintf("%s (%s key)", k.Label(), e.Type))
+			continue
+		}
+		if e.Algorithm != "" {
+			k.Algorithm = strings.ToUpper(e.Algorithm)
+		}
+		if e.Digits != 0 {
+			k.Digits = e.Digits
+		}
+		if e.Period != 0 {
+			k.Period = e.Period
+		}
+		k.Tags = e.Tags
+		keys = append(keys, k)
+	}
+	if len(skipped) > 0 {
+		return keys, &otpauth.UnsupportedError{Skipped: skipped}
+	}
+	return keys, nil
+}
+
+// Layout of encrypted backups: the PBKDF2 iterations, salt and IV precede the
+// AES-GCM ciphertext.
+const (
+	iterationsSize = 4
+	saltSize       = 12
+	ivSize         = 12
+
+	// andOTP uses around 150000 iterations. Anything far beyond that is an
+	// older backup, whose first bytes are not an iteration count.
+	maxIterations = 10000000
+)
+
+// decrypt decrypts a backup. Backups are encrypted with a key derived from
+// the password by PBKDF2-SHA1, or by older versions of andOTP, with the
+// SHA-256 of the password.
+func decrypt(data []byte, password string) ([]byte, error) {
+	if len(data) <= ivSize {
+		return nil, errors.New("The backup is too short")
+	}
+	iterations := int(binary.BigEndian.Uint32(data))
+	if len(data) > iterationsSize+saltSize+ivSize && iterations > 0 && iterations <= maxIterations {
+		salt := data[iterationsSize : iterationsSize+saltSize]
+		iv := data[iterationsSize+saltSize : iterationsSize+saltSize+ivSize]
+		key := pbkdf2.Key([]byte(password), salt, iterations, 32, sha1.New)
+		if plain, err := openGCM(key, iv, data[iterationsSize+saltSize+ivSize:]); err == nil {
+			return plain, nil
+		}
+	}
+	key := sha256.Sum256([]byte(password))
+	if plain, err := openGCM(key[:], data[:ivSize], data[ivSize:]); err == nil {
+		return plain, nil
+	}
+	return nil, errors.New("The password doesn't decrypt the backup")
+}
+
+func openGCM(key, iv, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, iv, ciphertext, nil)
+}
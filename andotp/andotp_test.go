@@ -0,0 +1,59 @@
+package andotp
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+func TestReadPlain(t *testing.T) {
+	f, err := os.Open("testdata/backup.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	keys, err := Read(f, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		uri  string
+		tags string
+	}{
+		{"otpauth://totp/GitHub:alice?digits=6&issuer=GitHub&secret=JBSWY3DPEHPK3PXP", "Work"},
+		{"otpauth://hotp/Google:bob@example.com?counter=7&digits=6&issuer=Google&secret=GEZDGNBVGY3TQOJQ", ""},
+		{"otpauth://steam/Steam:carol?digits=5&issuer=Steam&secret=KRUGKIDROVUWG2ZA", ""},
+		// Older backups have only a label
+		{"otpauth://totp/Example:erin?algorithm=SHA256&digits=8&issuer=Example&period=60&secret=ONSWG4TFOQQGC4TF", ""},
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Got %d keys, expected %d", len(keys), len(expected))
+	}
+	for i, k := range keys {
+		if k.URI() != expected[i].uri || strings.Join(k.Tags, ",") != expected[i].tags {
+			t.Errorf("Key %d: got %s tagged %v, expected %s tagged %q", i, k.URI(), k.Tags, expected[i].uri, expected[i].tags)
+		}
+	}
+}
+
+func TestReadSkipsUnsupported(t *testing.T) {
+	backup := `[{"secret":"JBSWY3DPEHPK3PXP","issuer":"GitHub","label":"alice","digits":6,"type":"TOTP","algorithm":"SHA1","period":30,"tags":[]},
+		{"secret":"MFRGGZDFMZTWQ2LK","issuer":"Example","label":"dave","digits":6,"type":"MOTP","algorithm":"MD5","period":10,"tags":[]}]`
+	keys, err := Read(strings.NewReader(backup), "")
+	uerr, ok := err.(*otpauth.UnsupportedError)
+	if !ok || len(uerr.Skipped) != 1 || !strings.Contains(uerr.Skipped[0], "Example:dave (MOTP key)") {
+		t.Errorf("Expected the MOTP entry to be skipped, got %v", err)
+	}
+	if len(keys) != 1 || keys[0].Issuer != "GitHub" {
+		t.Errorf("Expected the GitHub key to be read, got %+v", keys)
+	}
+}
+
+func TestReadEncryptedNeedsPassword(t *testing.T) {
+	if _, err := Read(strings.NewReader("\x00\x02\x49\xf0 not JSON"), ""); err != otpauth.ErrPasswordRequired {
+		t.Errorf("Expected a password to be required, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package authy
+
+import (
+	"context"
+	"crypto/rsa"
+)
+
+// API is the set of Authy API operations provided by Client.
+//
+// Code that depends on API rather than *Client can substitute another
+// implementation, such as the in-memory fake in package authytest.
+type API interface {
+	// QueryUser fetches the status of an Authy user account.
+	QueryUser(ctx context.Context, countryCallingCode int, phone string) (UserStatus, error)
+
+	// RequestDeviceRegistration begins a new device registration.
+	RequestDeviceRegistration(ctx context.Context, userID uint64, via ViaMethod) (StartDeviceRegistrationResponse, error)
+
+	// CheckDeviceRegistration fetches the status of a device registration request.
+	CheckDeviceRegistration(ctx context.Context, userID uint64, requestID string) (DeviceRegistrationStatus, error)
+
+	// CompleteDeviceRegistration completes an accepted device registration.
+	CompleteDeviceRegistration(ctx context.Context, userID uint64, pin string) (CompleteDeviceRegistrationResponse, error)
+
+	// QueryDevicePrivateKey fetches the private key of a registered device.
+	QueryDevicePrivateKey(ctx context.Context, deviceID uint64, deviceSeed string) (DevicePrivateKeyResponse, error)
+
+	// QueryAuthenticatorTokens fetches the encrypted TOTP tokens of a user.
+	QueryAuthenticatorTokens(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (AuthenticatorTokensResponse, error)
+
+	// QueryAuthenticatorApps fetches the Authy App tokens of a user.
+	QueryAuthenticatorApps(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (AuthenticatorAppsResponse, error)
+
+	// AddAuthenticatorToken uploads a new encrypted TOTP token.
+	AddAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+		tok AuthenticatorToken) (AuthenticatorTokenResponse, error)
+
+	// UpdateAuthenticatorToken replaces the stored fields of a TOTP token.
+	UpdateAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+		tok AuthenticatorToken) (AuthenticatorTokenResponse, error)
+
+	// DeleteAuthenticatorToken deletes a TOTP token.
+	DeleteAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+		uniqueID string) (SuccessResponse, error)
+
+	// RestoreAuthenticatorToken restores a deleted TOTP token.
+	RestoreAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+		uniqueID string) (SuccessResponse, error)
+
+	// RestoreAuthenticatorApp restores a deleted Authy App.
+	RestoreAuthenticatorApp(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+		appID string) (SuccessResponse, error)
+
+	// QueryApprovalRequests fetches the pending push authentication requests of a device.
+	QueryApprovalRequests(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (ApprovalRequestsResponse, error)
+
+	// RespondApprovalRequest approves or denies a push authentication request.
+	RespondApprovalRequest(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+		pk *rsa.PrivateKey, uuid string, approve bool) (SuccessResponse, error)
+}
+
+var _ API = (*Client)(nil)
@@ -0,0 +1,54 @@
+package authy
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// QueryApprovalRequests fetches the push authentication requests for the
+// device, authenticating using the deviceSeed (hex-encoded). Only pending
+// requests are returned.
+func (c *Client) QueryApprovalRequests(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (ApprovalRequestsResponse, error) {
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
+	if err != nil {
+		return ApprovalRequestsResponse{}, err
+	}
+	form.Set("status", "pending")
+	form.Set("locale", "en-GB")
+
+	var resp ApprovalRequestsResponse
+	return resp, c.doRequest(ctx, http.MethodGet,
+		fmt.Sprintf("users/%d/devices/%d/approval_requests?%s", userID, deviceID, form.Encode()), nil, &resp)
+}
+
+// RespondApprovalRequest approves or denies the push authentication request
+// with the UUID. Besides the device OTPs, the response must be signed with
+// the device private key (see QueryDevicePrivateKey).
+//
+// The signature is experimental, see signRequest, so Authy may reject
+// responses.
+func (c *Client) RespondApprovalRequest(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	pk *rsa.PrivateKey, uuid string, approve bool) (SuccessResponse, error) {
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
+	if err != nil {
+		return SuccessResponse{}, err
+	}
+	if approve {
+		form.Set("status", "approved")
+	} else {
+		form.Set("status", "denied")
+	}
+
+	path := fmt.Sprintf("users/%d/devices/%d/approval_requests/%s", userID, deviceID, uuid)
+	sig, err := signRequest(pk, http.MethodPut, path, form)
+	if err != nil {
+		return SuccessResponse{}, fmt.Errorf("Failed to sign the response: %v", err)
+	}
+	form.Set("signature", sig)
+
+	var resp SuccessResponse
+	return resp, c.doRequest(ctx, http.MethodPut, path, strings.NewReader(form.Encode()), &resp)
+}
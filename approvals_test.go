@@ -0,0 +1,136 @@
+package authy
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// approvalsClient returns a Client whose requests, besides clock syncs, are
+// answered by handle with a JSON body.
+func approvalsClient(t *testing.T, handle func(req *http.Request, form url.Values) string) *Client {
+	cl, err := NewClient(WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		resp := dateResponse(time.Now())
+		if req.Method == http.MethodHead {
+			return resp, nil
+		}
+		form := req.URL.Query()
+		if req.Body != nil {
+			buf, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			if form, err = url.ParseQuery(string(buf)); err != nil {
+				return nil, err
+			}
+		}
+		resp.Body = ioutil.NopCloser(strings.NewReader(handle(req, form)))
+		return resp, nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cl
+}
+
+// checkDeviceForm checks that the request is authenticated as the device.
+func checkDeviceForm(t *testing.T, form url.Values) {
+	t.Helper()
+	if form.Get("device_id") != "2" || form.Get("api_key") != apiKey {
+		t.Errorf("The request isn't from the device: %v", form)
+	}
+	for _, k := range []string{"otp1", "otp2", "otp3"} {
+		if len(form.Get(k)) != totpDigits {
+			t.Errorf("The request has no %s: %v", k, form)
+		}
+	}
+}
+
+func TestQueryApprovalRequests(t *testing.T) {
+	cl := approvalsClient(t, func(req *http.Request, form url.Values) string {
+		if req.Method != http.MethodGet || req.URL.Path != "/json/users/1/devices/2/approval_requests" {
+			t.Errorf("Unexpected request %s %s", req.Method, req.URL.Path)
+		}
+		checkDeviceForm(t, form)
+		if form.Get("status") != "pending" {
+			t.Errorf("Expected only pending requests to be asked for: %v", form)
+		}
+		return `{"approval_requests":[{"uuid":"abc","status":"pending","app_name":"Acme","message":"Login requested",` +
+			`"details":{"Location":"Sydney, AU","IP":"192.0.2.1"},"created_at":1577880000,"expires_at":1577880300}],"success":true}`
+	})
+
+	resp, err := cl.QueryApprovalRequests(context.Background(), 1, 2, "0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || len(resp.ApprovalRequests) != 1 {
+		t.Fatalf("Unexpected response %+v", resp)
+	}
+	r := resp.ApprovalRequests[0]
+	if r.UUID != "abc" || r.AppName != "Acme" || r.Location() != "Sydney, AU" || r.Details["IP"] != "192.0.2.1" {
+		t.Errorf("Unexpected request %+v", r)
+	}
+	created := time.Unix(r.CreatedAt, 0)
+	if !r.IsPending(created) || r.IsPending(time.Unix(r.ExpiresAt, 0)) {
+		t.Errorf("The request should be pending until %d", r.ExpiresAt)
+	}
+}
+
+func TestRespondApprovalRequest(t *testing.T) {
+	pk := testKey(t)
+	for _, approve := range []bool{true, false} {
+		expected := "denied"
+		if approve {
+			expected = "approved"
+		}
+		var requests int
+		cl := approvalsClient(t, func(req *http.Request, form url.Values) string {
+			requests++
+			path := "users/1/devices/2/approval_requests/abc"
+			if req.Method != http.MethodPut || req.URL.Path != "/json/"+path {
+				t.Errorf("Unexpected request %s %s", req.Method, req.URL.Path)
+			}
+			checkDeviceForm(t, form)
+			if form.Get("status") != expected {
+				t.Errorf("Expected the status %s, got %v", expected, form)
+			}
+
+			// The signature covers the rest of the form
+			sig, err := base64.StdEncoding.DecodeString(form.Get("signature"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			form.Del("signature")
+			digest := sha256.Sum256([]byte("PUT\n" + path + "\n" + form.Encode()))
+			if err := rsa.VerifyPKCS1v15(&pk.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+				t.Errorf("The signature doesn't verify: %v", err)
+			}
+			return `{"message":"Request ` + expected + `","success":true}`
+		})
+
+		resp, err := cl.RespondApprovalRequest(context.Background(), 1, 2, "0123456789abcdef", pk, "abc", approve)
+		if err != nil || !resp.Success {
+			t.Errorf("Responding with %s: %+v, %v", expected, resp, err)
+		}
+		if requests != 1 {
+			t.Errorf("Sent %d requests, expected 1", requests)
+		}
+	}
+
+	// Nothing is sent without the key to sign with
+	cl := approvalsClient(t, func(req *http.Request, form url.Values) string {
+		t.Errorf("Unexpected request %s %s", req.Method, req.URL.Path)
+		return "{}"
+	})
+	if _, err := cl.RespondApprovalRequest(context.Background(), 1, 2, "0123456789abcdef", nil, "abc", true); err == nil {
+		t.Error("Responded without a private key")
+	}
+}
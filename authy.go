@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -24,32 +26,89 @@ const (
 
 // Client provides API interaction with the Authy API.
 // See NewClient()
+//
+// A Client is safe for concurrent use by multiple goroutines, and should be
+// reused rather than created per request, so that connections are pooled and
+// the rate limit, if any, is shared. The exported fields must not be modified
+// once the Client is in use.
 type Client struct {
-	httpCl    http.Client
+	httpCl    *http.Client
 	UserAgent string
 	APIKey    string
 
+	// Now returns the local time that device OTPs are generated from.
+	// If nil, time.Now is used. Mostly useful for deterministic tests.
+	Now func() time.Time
+
 	// This doesn't seem to be a real nonce nor a signature, since
 	// it actually appears to be random bytes that get re-used between
 	// requests
 	nonce []byte
+
+	// Estimated offset of the Authy server clock
+	skew clockSkew
+
+	// Limits the rate of requests sent by this Client, nil if unlimited
+	limiter *rateLimiter
+}
+
+// ClientOption configures optional behaviour of a Client.
+// See NewClient()
+type ClientOption func(*Client)
+
+// WithTransport makes the Client send requests via rt, instead of the
+// connection pool shared by all Clients.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.httpCl = &http.Client{Transport: rt}
+	}
+}
+
+// WithRateLimit limits the Client to an average of perSecond requests per
+// second, allowing bursts of up to burst requests. Clients aren't rate
+// limited otherwise, but the Authy API is quick to suspend accounts that
+// misbehave, so long-running or concurrent users should set a limit no
+// faster than the official apps might send requests, such as 2 per second.
+// A perSecond of zero or less disables rate limiting.
+func WithRateLimit(perSecond float64, burst int) ClientOption {
+	return func(c *Client) {
+		c.limiter = newRateLimiter(perSecond, burst)
+	}
+}
+
+// Connection pool shared by all Clients
+var defaultTransport = &http.Transport{
+	Proxy: http.ProxyFromEnvironment,
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   10,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
 }
 
 // NewClient creates a new Authy API client.
-func NewClient() (Client, error) {
+func NewClient(opts ...ClientOption) (*Client, error) {
 	nonce, err := randomBytes(32)
 	if err != nil {
-		return Client{}, err
+		return nil, err
 	}
-	return Client{
-		httpCl:    http.Client{},
+	c := &Client{
+		httpCl:    &http.Client{Transport: defaultTransport},
 		UserAgent: "authy (https://github.com/alexzorin/authy)",
 		APIKey:    apiKey,
 		nonce:     nonce,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
 }
 
-func (c Client) doRequest(ctx context.Context, method, url string, body io.Reader, dest interface{}) error {
+func (c *Client) doRequest(ctx context.Context, method, url string, body io.Reader, dest interface{}) error {
 	req, err := http.NewRequest(method, baseURL+url, body)
 	if err != nil {
 		return err
@@ -59,14 +118,15 @@ func (c Client) doRequest(ctx context.Context, method, url string, body io.Reade
 		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 	}
-	req = req.WithContext(ctx)
-	req.Header.Set("user-agent", c.UserAgent)
 
-	resp, err := c.httpCl.Do(req)
+	resp, err := c.do(ctx, req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
+	// Drain whatever the decoder doesn't consume, so the connection can
+	// be reused
+	defer io.Copy(ioutil.Discard, resp.Body)
 
 	var r io.Reader = resp.Body
 	if os.Getenv("AUTHY_DEBUG") == "1" {
@@ -81,8 +141,47 @@ func (c Client) doRequest(ctx context.Context, method, url string, body io.Reade
 	return json.NewDecoder(r).Decode(&dest)
 }
 
+// do sends req once the rate limit allows, and records the server's clock
+// from the response.
+func (c *Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if err := c.limiter.wait(ctx); err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("user-agent", c.UserAgent)
+
+	sent := c.now()
+	resp, err := c.httpCl.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	c.skew.observe(resp, sent, c.now())
+	return resp, nil
+}
+
+// deviceForm returns the parameters which authenticate a request as the
+// device, which are 3 consecutive OTPs generated from the device seed.
+func (c *Client) deviceForm(ctx context.Context, deviceID uint64, deviceSeed string) (url.Values, error) {
+	t, err := c.otpTime(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to determine Authy server time: %v", err)
+	}
+	codes, err := generateTOTPCodes(deviceSeed, totpDigits, totpTimeStep, false, t)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to generate TOTP codes: %v", err)
+	}
+
+	form := url.Values{}
+	form.Set("api_key", apiKey)
+	form.Set("device_id", strconv.FormatUint(deviceID, 10))
+	form.Set("otp1", codes[0])
+	form.Set("otp2", codes[1])
+	form.Set("otp3", codes[2])
+	return form, nil
+}
+
 // QueryUser fetches the status of an Authy user account.
-func (c Client) QueryUser(ctx context.Context, countryCallingCode int, phone string) (UserStatus, error) {
+func (c *Client) QueryUser(ctx context.Context, countryCallingCode int, phone string) (UserStatus, error) {
 	var us UserStatus
 	return us, c.doRequest(ctx, http.MethodGet, fmt.Sprintf("users/%d-%s/status", countryCallingCode, phone),
 		nil, &us)
@@ -90,7 +189,7 @@ func (c Client) QueryUser(ctx context.Context, countryCallingCode int, phone str
 
 // RequestDeviceRegistration begins a new device registration for an Authy User account,
 // via the nominated mechanism.
-func (c Client) RequestDeviceRegistration(ctx context.Context, userID uint64, via ViaMethod) (StartDeviceRegistrationResponse, error) {
+func (c *Client) RequestDeviceRegistration(ctx context.Context, userID uint64, via ViaMethod) (StartDeviceRegistrationResponse, error) {
 	form := url.Values{}
 	form.Set("api_key", c.APIKey)
 	form.Set("via", string(via))
@@ -104,7 +203,7 @@ func (c Client) RequestDeviceRegistration(ctx context.Context, userID uint64, vi
 
 // CheckDeviceRegistration fetches the status of the device registration request (requestID) for the
 // nominated Authy User ID (userID). This should be polled with a timeout.
-func (c Client) CheckDeviceRegistration(ctx context.Context, userID uint64, requestID string) (DeviceRegistrationStatus, error) {
+func (c *Client) CheckDeviceRegistration(ctx context.Context, userID uint64, requestID string) (DeviceRegistrationStatus, error) {
 	form := url.Values{}
 	form.Set("api_key", c.APIKey)
 	form.Set("signature", hex.EncodeToString(c.nonce))
@@ -116,7 +215,7 @@ func (c Client) CheckDeviceRegistration(ctx context.Context, userID uint64, requ
 
 // CompleteDeviceRegistration completes the device registration process for the nominated Authy User ID
 // (userID) and PIN (from the DeviceRegistrationStatus)
-func (c Client) CompleteDeviceRegistration(ctx context.Context, userID uint64, pin string) (CompleteDeviceRegistrationResponse, error) {
+func (c *Client) CompleteDeviceRegistration(ctx context.Context, userID uint64, pin string) (CompleteDeviceRegistrationResponse, error) {
 	form := url.Values{}
 	form.Set("api_key", c.APIKey)
 	form.Set("pin", pin)
@@ -129,20 +228,13 @@ func (c Client) CompleteDeviceRegistration(ctx context.Context, userID uint64, p
 
 // QueryDevicePrivateKey fetches the PKCS#1 private key for the nominated device ID, using the
 // known device secret TOTP seed from CompleteDeviceRegistrationResponse.
-func (c Client) QueryDevicePrivateKey(ctx context.Context, deviceID uint64, deviceSeed string) (DevicePrivateKeyResponse, error) {
+func (c *Client) QueryDevicePrivateKey(ctx context.Context, deviceID uint64, deviceSeed string) (DevicePrivateKeyResponse, error) {
 	// We need to generate 3 OTPs using the device seed in order to get access to the device private key
-	codes, err := generateTOTPCodes(deviceSeed, totpDigits, totpTimeStep, false)
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
 	if err != nil {
-		return DevicePrivateKeyResponse{}, fmt.Errorf("Failed to generate TOTP codes: %v", err)
+		return DevicePrivateKeyResponse{}, err
 	}
 
-	form := url.Values{}
-	form.Set("api_key", apiKey)
-	form.Set("device_id", strconv.FormatUint(deviceID, 10))
-	form.Set("otp1", codes[0])
-	form.Set("otp2", codes[1])
-	form.Set("otp3", codes[2])
-
 	var resp DevicePrivateKeyResponse
 	return resp, c.doRequest(ctx, http.MethodGet,
 		fmt.Sprintf("devices/%d/rsa_key?%s", deviceID, form.Encode()), nil, &resp)
@@ -150,18 +242,11 @@ func (c Client) QueryDevicePrivateKey(ctx context.Context, deviceID uint64, devi
 
 // QueryAuthenticatorTokens fetches the encrypted TOTP tokens for userID, authenticating
 // using the deviceSeed (hex-encoded).
-func (c Client) QueryAuthenticatorTokens(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (AuthenticatorTokensResponse, error) {
-	codes, err := generateTOTPCodes(deviceSeed, totpDigits, totpTimeStep, false)
+func (c *Client) QueryAuthenticatorTokens(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (AuthenticatorTokensResponse, error) {
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
 	if err != nil {
-		return AuthenticatorTokensResponse{}, fmt.Errorf("Failed to generate TOTP codes: %v", err)
+		return AuthenticatorTokensResponse{}, err
 	}
-
-	form := url.Values{}
-	form.Set("api_key", apiKey)
-	form.Set("device_id", strconv.FormatUint(deviceID, 10))
-	form.Set("otp1", codes[0])
-	form.Set("otp2", codes[1])
-	form.Set("otp3", codes[2])
 	form.Set("apps", "")
 
 	var resp AuthenticatorTokensResponse
@@ -171,18 +256,11 @@ func (c Client) QueryAuthenticatorTokens(ctx context.Context, userID uint64, dev
 
 // QueryAuthenticatorApps fetches the encrypted Authy App tokens for userID,
 // authenticating using the deviceSeed (hex-encoded).
-func (c Client) QueryAuthenticatorApps(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (AuthenticatorAppsResponse, error) {
-	codes, err := generateTOTPCodes(deviceSeed, totpDigits, totpTimeStep, false)
+func (c *Client) QueryAuthenticatorApps(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (AuthenticatorAppsResponse, error) {
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
 	if err != nil {
-		return AuthenticatorAppsResponse{}, fmt.Errorf("Failed to generate TOTP codes: %v", err)
+		return AuthenticatorAppsResponse{}, err
 	}
-
-	form := url.Values{}
-	form.Set("api_key", apiKey)
-	form.Set("device_id", strconv.FormatUint(deviceID, 10))
-	form.Set("otp1", codes[0])
-	form.Set("otp2", codes[1])
-	form.Set("otp3", codes[2])
 	form.Set("locale", "en-GB")
 
 	var resp AuthenticatorAppsResponse
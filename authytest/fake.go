@@ -0,0 +1,537 @@
+// Package authytest provides an in-memory implementation of authy.API, so
+// that code using the Authy API can be tested without any HTTP.
+package authytest
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexzorin/authy"
+)
+
+// User is an Authy account held by a Fake.
+type User struct {
+	AuthyID uint64
+
+	// Encrypted authenticator tokens, as returned by QueryAuthenticatorTokens
+	Tokens        []authy.AuthenticatorToken
+	DeletedTokens []authy.AuthenticatorToken
+
+	// Authy Apps, as returned by QueryAuthenticatorApps
+	Apps        []authy.AuthenticatorApp
+	DeletedApps []authy.AuthenticatorApp
+
+	// Push authentication requests, which are returned by
+	// QueryApprovalRequests while they are pending
+	ApprovalRequests []authy.ApprovalRequest
+
+	devices int
+}
+
+// Device is a device registered to a User of a Fake.
+type Device struct {
+	ID         uint64
+	UserID     uint64
+	SecretSeed string
+
+	privateKey *rsa.PrivateKey
+}
+
+type registration struct {
+	userID uint64
+	status string
+	pin    string
+}
+
+// Fake is an in-memory implementation of authy.API.
+//
+// Users are added with AddUser. Device registration requests stay pending
+// until they are approved or rejected, unless AutoApprove is set. Device-
+// authenticated methods check the device seed rather than OTPs, and report
+// failures in the response (with Success false), as the Authy API does.
+//
+// A Fake is safe for concurrent use, but its exported fields, and those of
+// its Users, must not be modified while it is in use.
+type Fake struct {
+	// AutoApprove accepts device registration requests as soon as they are made.
+	AutoApprove bool
+
+	// Intercept, if set, is called with the name of each authy.API method
+	// before it is handled, e.g. "UpdateAuthenticatorToken". If it returns
+	// an error, the method fails with it. It is called outside of the Fake's
+	// lock, so it may modify Users, to simulate changes made elsewhere. Like
+	// the other fields, it must be set before the Fake is used.
+	Intercept func(method string) error
+
+	mu            sync.Mutex
+	lastID        uint64
+	users         map[string]*User
+	usersByID     map[uint64]*User
+	registrations map[string]*registration
+	devices       map[uint64]*Device
+}
+
+var _ authy.API = (*Fake)(nil)
+
+// NewFake creates an empty Fake.
+func NewFake() *Fake {
+	return &Fake{
+		users:         map[string]*User{},
+		usersByID:     map[uint64]*User{},
+		registrations: map[string]*registration{},
+		devices:       map[uint64]*Device{},
+	}
+}
+
+func (f *Fake) intercept(method string) error {
+	if f.Intercept == nil {
+		return nil
+	}
+	return f.Intercept(method)
+}
+
+func (f *Fake) nextID() uint64 {
+	f.lastID++
+	return f.lastID
+}
+
+// AddUser creates an Authy account for the phone number.
+func (f *Fake) AddUser(countryCallingCode int, phone string) *User {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u := &User{AuthyID: f.nextID()}
+	f.users[fmt.Sprintf("%d-%s", countryCallingCode, phone)] = u
+	f.usersByID[u.AuthyID] = u
+	return u
+}
+
+// AddDevice registers a new device to the user with the Authy ID, as if it
+// had completed device registration.
+func (f *Fake) AddDevice(userID uint64) (*Device, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.usersByID[userID]
+	if !ok {
+		return nil, fmt.Errorf("no such user: %d", userID)
+	}
+	return f.newDevice(u)
+}
+
+func (f *Fake) newDevice(u *User) (*Device, error) {
+	seed := make([]byte, 32)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	d := &Device{
+		ID:         f.nextID(),
+		UserID:     u.AuthyID,
+		SecretSeed: hex.EncodeToString(seed),
+	}
+	f.devices[d.ID] = d
+	u.devices++
+	return d, nil
+}
+
+// ApproveRegistration accepts the pending device registration request,
+// as if it had been approved from another device.
+func (f *Fake) ApproveRegistration(requestID string) error {
+	return f.resolveRegistration(requestID, "accepted")
+}
+
+// RejectRegistration rejects the pending device registration request.
+func (f *Fake) RejectRegistration(requestID string) error {
+	return f.resolveRegistration(requestID, "rejected")
+}
+
+func (f *Fake) resolveRegistration(requestID, status string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, ok := f.registrations[requestID]
+	if !ok {
+		return fmt.Errorf("no such registration request: %s", requestID)
+	}
+	if r.status != "pending" {
+		return fmt.Errorf("registration request %s is already %s", requestID, r.status)
+	}
+	r.status = status
+	return nil
+}
+
+// Device returns the registered device with the ID, or nil.
+func (f *Fake) Device(deviceID uint64) *Device {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.devices[deviceID]
+}
+
+// QueryUser implements authy.API.
+func (f *Fake) QueryUser(ctx context.Context, countryCallingCode int, phone string) (authy.UserStatus, error) {
+	if err := f.intercept("QueryUser"); err != nil {
+		return authy.UserStatus{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.users[fmt.Sprintf("%d-%s", countryCallingCode, phone)]
+	if !ok {
+		return authy.UserStatus{Message: "new", Success: true}, nil
+	}
+	return authy.UserStatus{
+		DevicesCount: u.devices,
+		AuthyID:      u.AuthyID,
+		Message:      "active",
+		Success:      true,
+	}, nil
+}
+
+// RequestDeviceRegistration implements authy.API.
+func (f *Fake) RequestDeviceRegistration(ctx context.Context, userID uint64, via authy.ViaMethod) (authy.StartDeviceRegistrationResponse, error) {
+	if err := f.intercept("RequestDeviceRegistration"); err != nil {
+		return authy.StartDeviceRegistrationResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.usersByID[userID]; !ok {
+		return authy.StartDeviceRegistrationResponse{Message: "User not found."}, nil
+	}
+	id := f.nextID()
+	r := &registration{
+		userID: userID,
+		status: "pending",
+		pin:    fmt.Sprintf("%06d", id),
+	}
+	if f.AutoApprove {
+		r.status = "accepted"
+	}
+	requestID := strconv.FormatUint(id, 10)
+	f.registrations[requestID] = r
+	return authy.StartDeviceRegistrationResponse{
+		Message:   "A request was sent to your other devices.",
+		RequestID: requestID,
+		Provider:  string(via),
+		Success:   true,
+	}, nil
+}
+
+// CheckDeviceRegistration implements authy.API.
+func (f *Fake) CheckDeviceRegistration(ctx context.Context, userID uint64, requestID string) (authy.DeviceRegistrationStatus, error) {
+	if err := f.intercept("CheckDeviceRegistration"); err != nil {
+		return authy.DeviceRegistrationStatus{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, ok := f.registrations[requestID]
+	if !ok || r.userID != userID {
+		return authy.DeviceRegistrationStatus{}, nil
+	}
+	st := authy.DeviceRegistrationStatus{Status: r.status, Success: true}
+	if r.status == "accepted" {
+		st.PIN = r.pin
+	}
+	return st, nil
+}
+
+// CompleteDeviceRegistration implements authy.API.
+func (f *Fake) CompleteDeviceRegistration(ctx context.Context, userID uint64, pin string) (authy.CompleteDeviceRegistrationResponse, error) {
+	if err := f.intercept("CompleteDeviceRegistration"); err != nil {
+		return authy.CompleteDeviceRegistrationResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var resp authy.CompleteDeviceRegistrationResponse
+	u, ok := f.usersByID[userID]
+	if !ok {
+		return resp, nil
+	}
+	for id, r := range f.registrations {
+		if r.userID != userID || r.status != "accepted" || r.pin != pin {
+			continue
+		}
+		d, err := f.newDevice(u)
+		if err != nil {
+			return resp, err
+		}
+		delete(f.registrations, id)
+
+		resp.Device.ID = d.ID
+		resp.Device.SecretSeed = d.SecretSeed
+		resp.AuthyID = userID
+		return resp, nil
+	}
+	return resp, nil
+}
+
+// authenticate returns the device, if deviceSeed is its secret seed.
+func (f *Fake) authenticate(deviceID uint64, deviceSeed string) (*Device, bool) {
+	d, ok := f.devices[deviceID]
+	if !ok || d.SecretSeed != deviceSeed {
+		return nil, false
+	}
+	return d, true
+}
+
+// QueryDevicePrivateKey implements authy.API.
+func (f *Fake) QueryDevicePrivateKey(ctx context.Context, deviceID uint64, deviceSeed string) (authy.DevicePrivateKeyResponse, error) {
+	if err := f.intercept("QueryDevicePrivateKey"); err != nil {
+		return authy.DevicePrivateKeyResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok {
+		return authy.DevicePrivateKeyResponse{Message: "Invalid OTP"}, nil
+	}
+	if d.privateKey == nil {
+		pk, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return authy.DevicePrivateKeyResponse{}, err
+		}
+		d.privateKey = pk
+	}
+	return authy.DevicePrivateKeyResponse{
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(d.privateKey),
+		})),
+		Success: true,
+	}, nil
+}
+
+// QueryAuthenticatorTokens implements authy.API.
+func (f *Fake) QueryAuthenticatorTokens(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (authy.AuthenticatorTokensResponse, error) {
+	if err := f.intercept("QueryAuthenticatorTokens"); err != nil {
+		return authy.AuthenticatorTokensResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok || d.UserID != userID {
+		return authy.AuthenticatorTokensResponse{Message: "Invalid OTP"}, nil
+	}
+	u := f.usersByID[userID]
+	return authy.AuthenticatorTokensResponse{
+		AuthenticatorTokens: append([]authy.AuthenticatorToken{}, u.Tokens...),
+		Deleted:             append([]authy.AuthenticatorToken{}, u.DeletedTokens...),
+		Success:             true,
+	}, nil
+}
+
+// QueryAuthenticatorApps implements authy.API.
+func (f *Fake) QueryAuthenticatorApps(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (authy.AuthenticatorAppsResponse, error) {
+	if err := f.intercept("QueryAuthenticatorApps"); err != nil {
+		return authy.AuthenticatorAppsResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok || d.UserID != userID {
+		return authy.AuthenticatorAppsResponse{Message: "Invalid OTP"}, nil
+	}
+	u := f.usersByID[userID]
+	return authy.AuthenticatorAppsResponse{
+		AuthenticatorApps: append([]authy.AuthenticatorApp{}, u.Apps...),
+		Deleted:           append([]authy.AuthenticatorApp{}, u.DeletedApps...),
+		Success:           true,
+	}, nil
+}
+
+// AddAuthenticatorToken implements authy.API.
+func (f *Fake) AddAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	tok authy.AuthenticatorToken) (authy.AuthenticatorTokenResponse, error) {
+	if err := f.intercept("AddAuthenticatorToken"); err != nil {
+		return authy.AuthenticatorTokenResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok || d.UserID != userID {
+		return authy.AuthenticatorTokenResponse{Message: "Invalid OTP"}, nil
+	}
+	if tok.EncryptedSeed == "" || tok.Salt == "" {
+		return authy.AuthenticatorTokenResponse{Message: "Missing encrypted seed"}, nil
+	}
+	u := f.usersByID[userID]
+	tok.UniqueID = strconv.FormatUint(f.nextID(), 10)
+	if tok.OriginalName == "" {
+		tok.OriginalName = tok.Name
+	}
+	u.Tokens = append(u.Tokens, tok)
+	return authy.AuthenticatorTokenResponse{AuthenticatorToken: tok, Success: true}, nil
+}
+
+// UpdateAuthenticatorToken implements authy.API.
+func (f *Fake) UpdateAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	tok authy.AuthenticatorToken) (authy.AuthenticatorTokenResponse, error) {
+	if err := f.intercept("UpdateAuthenticatorToken"); err != nil {
+		return authy.AuthenticatorTokenResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok || d.UserID != userID {
+		return authy.AuthenticatorTokenResponse{Message: "Invalid OTP"}, nil
+	}
+	u := f.usersByID[userID]
+	for i := range u.Tokens {
+		if u.Tokens[i].UniqueID == tok.UniqueID {
+			tok.OriginalName = u.Tokens[i].OriginalName
+			u.Tokens[i] = tok
+			return authy.AuthenticatorTokenResponse{AuthenticatorToken: tok, Success: true}, nil
+		}
+	}
+	return authy.AuthenticatorTokenResponse{Message: "Token not found"}, nil
+}
+
+// DeleteAuthenticatorToken implements authy.API.
+func (f *Fake) DeleteAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	uniqueID string) (authy.SuccessResponse, error) {
+	if err := f.intercept("DeleteAuthenticatorToken"); err != nil {
+		return authy.SuccessResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok || d.UserID != userID {
+		return authy.SuccessResponse{Message: "Invalid OTP"}, nil
+	}
+	u := f.usersByID[userID]
+	var found bool
+	u.Tokens, u.DeletedTokens, found = moveToken(u.Tokens, u.DeletedTokens, uniqueID)
+	if !found {
+		return authy.SuccessResponse{Message: "Token not found"}, nil
+	}
+	return authy.SuccessResponse{Success: true}, nil
+}
+
+// RestoreAuthenticatorToken implements authy.API.
+func (f *Fake) RestoreAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	uniqueID string) (authy.SuccessResponse, error) {
+	if err := f.intercept("RestoreAuthenticatorToken"); err != nil {
+		return authy.SuccessResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok || d.UserID != userID {
+		return authy.SuccessResponse{Message: "Invalid OTP"}, nil
+	}
+	u := f.usersByID[userID]
+	var found bool
+	u.DeletedTokens, u.Tokens, found = moveToken(u.DeletedTokens, u.Tokens, uniqueID)
+	if !found {
+		return authy.SuccessResponse{Message: "Token not found"}, nil
+	}
+	return authy.SuccessResponse{Success: true}, nil
+}
+
+// RestoreAuthenticatorApp implements authy.API.
+func (f *Fake) RestoreAuthenticatorApp(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	appID string) (authy.SuccessResponse, error) {
+	if err := f.intercept("RestoreAuthenticatorApp"); err != nil {
+		return authy.SuccessResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok || d.UserID != userID {
+		return authy.SuccessResponse{Message: "Invalid OTP"}, nil
+	}
+	u := f.usersByID[userID]
+	for i, app := range u.DeletedApps {
+		if app.ID == appID {
+			u.DeletedApps = append(u.DeletedApps[:i:i], u.DeletedApps[i+1:]...)
+			u.Apps = append(u.Apps, app)
+			return authy.SuccessResponse{Success: true}, nil
+		}
+	}
+	return authy.SuccessResponse{Message: "App not found"}, nil
+}
+
+// moveToken moves the token with uniqueID from src to dst.
+func moveToken(src, dst []authy.AuthenticatorToken, uniqueID string) ([]authy.AuthenticatorToken, []authy.AuthenticatorToken, bool) {
+	for i, tok := range src {
+		if tok.UniqueID == uniqueID {
+			src = append(src[:i:i], src[i+1:]...)
+			return src, append(dst, tok), true
+		}
+	}
+	return src, dst, false
+}
+
+// QueryApprovalRequests implements authy.API.
+func (f *Fake) QueryApprovalRequests(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string) (authy.ApprovalRequestsResponse, error) {
+	if err := f.intercept("QueryApprovalRequests"); err != nil {
+		return authy.ApprovalRequestsResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok || d.UserID != userID {
+		return authy.ApprovalRequestsResponse{Message: "Invalid OTP"}, nil
+	}
+	resp := authy.ApprovalRequestsResponse{ApprovalRequests: []authy.ApprovalRequest{}, Success: true}
+	for _, r := range f.usersByID[userID].ApprovalRequests {
+		if r.IsPending(time.Now()) {
+			resp.ApprovalRequests = append(resp.ApprovalRequests, r)
+		}
+	}
+	return resp, nil
+}
+
+// RespondApprovalRequest implements authy.API. The response must be signed
+// with the private key issued to the device by QueryDevicePrivateKey.
+func (f *Fake) RespondApprovalRequest(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	pk *rsa.PrivateKey, uuid string, approve bool) (authy.SuccessResponse, error) {
+	if err := f.intercept("RespondApprovalRequest"); err != nil {
+		return authy.SuccessResponse{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.authenticate(deviceID, deviceSeed)
+	if !ok || d.UserID != userID {
+		return authy.SuccessResponse{Message: "Invalid OTP"}, nil
+	}
+	if pk == nil || d.privateKey == nil || pk.N.Cmp(d.privateKey.N) != 0 {
+		return authy.SuccessResponse{Message: "Invalid signature"}, nil
+	}
+	reqs := f.usersByID[userID].ApprovalRequests
+	for i := range reqs {
+		if reqs[i].UUID != uuid {
+			continue
+		}
+		if !reqs[i].IsPending(time.Now()) {
+			return authy.SuccessResponse{Message: "Approval request is no longer pending"}, nil
+		}
+		if approve {
+			reqs[i].Status = "approved"
+		} else {
+			reqs[i].Status = "denied"
+		}
+		return authy.SuccessResponse{Success: true}, nil
+	}
+	return authy.SuccessResponse{Message: "Approval request not found"}, nil
+}
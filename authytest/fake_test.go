@@ -0,0 +1,226 @@
+package authytest_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexzorin/authy"
+	"github.com/alexzorin/authy/authytest"
+)
+
+const testSeed = "JBSWY3DPEHPK3PXP"
+
+func TestDeviceRegistration(t *testing.T) {
+	f := authytest.NewFake()
+	u := f.AddUser(1, "5551234")
+	ctx := context.Background()
+
+	status, err := f.QueryUser(ctx, 1, "5551234")
+	if err != nil || status.AuthyID != u.AuthyID {
+		t.Fatalf("QueryUser: %+v, %v", status, err)
+	}
+	start, err := f.RequestDeviceRegistration(ctx, u.AuthyID, authy.ViaMethodPush)
+	if err != nil || !start.Success {
+		t.Fatalf("RequestDeviceRegistration: %+v, %v", start, err)
+	}
+	if st, _ := f.CheckDeviceRegistration(ctx, u.AuthyID, start.RequestID); st.Status != "pending" || st.PIN != "" {
+		t.Fatalf("Expected a pending registration without a PIN, got %+v", st)
+	}
+	if err := f.ApproveRegistration(start.RequestID); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := f.CheckDeviceRegistration(ctx, u.AuthyID, start.RequestID)
+	if st.Status != "accepted" || st.PIN == "" {
+		t.Fatalf("Expected an accepted registration with a PIN, got %+v", st)
+	}
+	complete, err := f.CompleteDeviceRegistration(ctx, u.AuthyID, st.PIN)
+	if err != nil || complete.Device.ID == 0 || f.Device(complete.Device.ID) == nil {
+		t.Fatalf("CompleteDeviceRegistration: %+v, %v", complete, err)
+	}
+	if status, _ := f.QueryUser(ctx, 1, "5551234"); status.DevicesCount != 1 {
+		t.Errorf("Expected 1 device, got %d", status.DevicesCount)
+	}
+}
+
+// newDevice returns a Fake with a user and a registered device.
+func newDevice(t *testing.T) (*authytest.Fake, *authytest.User, *authytest.Device) {
+	f := authytest.NewFake()
+	u := f.AddUser(1, "5551234")
+	d, err := f.AddDevice(u.AuthyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, u, d
+}
+
+func TestTokenLifecycle(t *testing.T) {
+	f, u, d := newDevice(t)
+	ctx := context.Background()
+
+	// Add a token encrypted on the client
+	tok := authy.AuthenticatorToken{Name: "GitHub", AccountType: "github", Digits: 6}
+	if err := tok.Encrypt(testSeed, "backup password"); err != nil {
+		t.Fatal(err)
+	}
+	added, err := f.AddAuthenticatorToken(ctx, u.AuthyID, d.ID, d.SecretSeed, tok)
+	if err != nil || !added.Success || added.AuthenticatorToken.UniqueID == "" {
+		t.Fatalf("AddAuthenticatorToken: %+v, %v", added, err)
+	}
+	id := added.AuthenticatorToken.UniqueID
+
+	toks, err := f.QueryAuthenticatorTokens(ctx, u.AuthyID, d.ID, d.SecretSeed)
+	if err != nil || len(toks.AuthenticatorTokens) != 1 {
+		t.Fatalf("QueryAuthenticatorTokens: %+v, %v", toks, err)
+	}
+	if seed, err := toks.AuthenticatorTokens[0].Decrypt("backup password"); err != nil || seed != testSeed {
+		t.Errorf("The uploaded token decrypted to %q, %v", seed, err)
+	}
+	// A wrong password may leave valid padding by chance, but never the seed
+	if seed, err := toks.AuthenticatorTokens[0].Decrypt("wrong password"); err == nil && seed == testSeed {
+		t.Error("The uploaded token decrypted with the wrong password")
+	}
+
+	// Rename it
+	renamed := toks.AuthenticatorTokens[0]
+	renamed.Name = "GitHub (work)"
+	renamed.AccountType = "authenticator"
+	if resp, err := f.UpdateAuthenticatorToken(ctx, u.AuthyID, d.ID, d.SecretSeed, renamed); err != nil || !resp.Success {
+		t.Fatalf("UpdateAuthenticatorToken: %+v, %v", resp, err)
+	}
+	toks, _ = f.QueryAuthenticatorTokens(ctx, u.AuthyID, d.ID, d.SecretSeed)
+	got := toks.AuthenticatorTokens[0]
+	if got.Name != "GitHub (work)" || got.AccountType != "authenticator" || got.OriginalName != "GitHub" {
+		t.Errorf("Unexpected token after the update: %+v", got)
+	}
+
+	// Delete and restore it
+	if resp, err := f.DeleteAuthenticatorToken(ctx, u.AuthyID, d.ID, d.SecretSeed, id); err != nil || !resp.Success {
+		t.Fatalf("DeleteAuthenticatorToken: %+v, %v", resp, err)
+	}
+	toks, _ = f.QueryAuthenticatorTokens(ctx, u.AuthyID, d.ID, d.SecretSeed)
+	if len(toks.AuthenticatorTokens) != 0 || len(toks.Deleted) != 1 || toks.Deleted[0].UniqueID != id {
+		t.Fatalf("Expected the token to be deleted, got %+v", toks)
+	}
+	if resp, err := f.RestoreAuthenticatorToken(ctx, u.AuthyID, d.ID, d.SecretSeed, id); err != nil || !resp.Success {
+		t.Fatalf("RestoreAuthenticatorToken: %+v, %v", resp, err)
+	}
+	toks, _ = f.QueryAuthenticatorTokens(ctx, u.AuthyID, d.ID, d.SecretSeed)
+	if len(toks.AuthenticatorTokens) != 1 || len(toks.Deleted) != 0 {
+		t.Fatalf("Expected the token to be restored, got %+v", toks)
+	}
+	if resp, _ := f.DeleteAuthenticatorToken(ctx, u.AuthyID, d.ID, d.SecretSeed, "no such token"); resp.Success {
+		t.Error("Deleted a token which doesn't exist")
+	}
+}
+
+func TestRestoreApp(t *testing.T) {
+	f, u, d := newDevice(t)
+	u.DeletedApps = []authy.AuthenticatorApp{{ID: "app1", Name: "Twitch", SecretSeed: "0123456789abcdef"}}
+	ctx := context.Background()
+
+	if resp, err := f.RestoreAuthenticatorApp(ctx, u.AuthyID, d.ID, d.SecretSeed, "app1"); err != nil || !resp.Success {
+		t.Fatalf("RestoreAuthenticatorApp: %+v, %v", resp, err)
+	}
+	apps, err := f.QueryAuthenticatorApps(ctx, u.AuthyID, d.ID, d.SecretSeed)
+	if err != nil || len(apps.AuthenticatorApps) != 1 || len(apps.Deleted) != 0 {
+		t.Fatalf("Expected the app to be restored, got %+v, %v", apps, err)
+	}
+}
+
+func TestDeviceAuthentication(t *testing.T) {
+	f, u, d := newDevice(t)
+	ctx := context.Background()
+
+	if toks, _ := f.QueryAuthenticatorTokens(ctx, u.AuthyID, d.ID, "not the seed"); toks.Success {
+		t.Error("Fetched the tokens with the wrong device seed")
+	}
+	other := f.AddUser(1, "5550000")
+	if toks, _ := f.QueryAuthenticatorTokens(ctx, other.AuthyID, d.ID, d.SecretSeed); toks.Success {
+		t.Error("Fetched another user's tokens")
+	}
+}
+
+func TestIntercept(t *testing.T) {
+	f, u, d := newDevice(t)
+	failure := errors.New("connection reset")
+	f.Intercept = func(method string) error {
+		if method == "QueryAuthenticatorApps" {
+			return failure
+		}
+		return nil
+	}
+	ctx := context.Background()
+
+	if _, err := f.QueryAuthenticatorApps(ctx, u.AuthyID, d.ID, d.SecretSeed); err != failure {
+		t.Errorf("Expected the intercepted error, got %v", err)
+	}
+	if toks, err := f.QueryAuthenticatorTokens(ctx, u.AuthyID, d.ID, d.SecretSeed); err != nil || !toks.Success {
+		t.Errorf("Other methods should succeed, got %+v, %v", toks, err)
+	}
+}
+
+func TestApprovalRequests(t *testing.T) {
+	f, u, d := newDevice(t)
+	now := time.Now().Unix()
+	u.ApprovalRequests = []authy.ApprovalRequest{
+		{UUID: "pending", Status: "pending", CreatedAt: now, ExpiresAt: now + 300},
+		{UUID: "expired", Status: "pending", CreatedAt: now - 600, ExpiresAt: now - 300},
+		{UUID: "approved", Status: "approved", CreatedAt: now, ExpiresAt: now + 300},
+	}
+	ctx := context.Background()
+
+	reqs, err := f.QueryApprovalRequests(ctx, u.AuthyID, d.ID, d.SecretSeed)
+	if err != nil || len(reqs.ApprovalRequests) != 1 || reqs.ApprovalRequests[0].UUID != "pending" {
+		t.Fatalf("Expected only the pending request, got %+v, %v", reqs, err)
+	}
+	if reqs, _ := f.QueryApprovalRequests(ctx, u.AuthyID, d.ID, "not the seed"); reqs.Success {
+		t.Error("Fetched the approval requests with the wrong device seed")
+	}
+
+	// Responses must be signed with the device's key
+	keyResp, err := f.QueryDevicePrivateKey(ctx, d.ID, d.SecretSeed)
+	if err != nil || !keyResp.Success {
+		t.Fatalf("QueryDevicePrivateKey: %+v, %v", keyResp, err)
+	}
+	pk, err := authy.ParsePrivateKey(keyResp.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := f.RespondApprovalRequest(ctx, u.AuthyID, d.ID, d.SecretSeed, other, "pending", true); resp.Success {
+		t.Error("Responded with another key")
+	}
+	if resp, _ := f.RespondApprovalRequest(ctx, u.AuthyID, d.ID, d.SecretSeed, nil, "pending", true); resp.Success {
+		t.Error("Responded without a key")
+	}
+
+	for _, tc := range []struct {
+		uuid    string
+		approve bool
+		success bool
+	}{
+		{"expired", true, false},
+		{"approved", false, false},
+		{"missing", true, false},
+		{"pending", false, true},
+		{"pending", true, false},
+	} {
+		resp, err := f.RespondApprovalRequest(ctx, u.AuthyID, d.ID, d.SecretSeed, pk, tc.uuid, tc.approve)
+		if err != nil || resp.Success != tc.success {
+			t.Errorf("Responding to %q with %v: %+v, %v", tc.uuid, tc.approve, resp, err)
+		}
+	}
+	if status := u.ApprovalRequests[0].Status; status != "denied" {
+		t.Errorf("Expected the request to be denied, got %q", status)
+	}
+	if reqs, _ := f.QueryApprovalRequests(ctx, u.AuthyID, d.ID, d.SecretSeed); len(reqs.ApprovalRequests) != 0 {
+		t.Errorf("Expected no pending requests after responding, got %+v", reqs.ApprovalRequests)
+	}
+}
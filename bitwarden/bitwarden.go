@@ -0,0 +1,133 @@
+// Package bitwarden reads and writes vault exports in Bitwarden's JSON
+// format, which holds logins with their TOTP secrets, either as plain JSON or
+// in its password-protected encrypted format.
+package bitwarden
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Item types
+const (
+	TypeLogin = 1
+)
+
+// Export is a Bitwarden vault export. Items of an individual vault are
+// organized in Folders, and those of an organization in Collections.
+type Export struct {
+	Encrypted   bool         `json:"encrypted"`
+	Folders     []Folder     `json:"folders,omitempty"`
+	Collections []Collection `json:"collections,omitempty"`
+	Items       []Item       `json:"items"`
+}
+
+// Folder is a folder in an individual vault.
+type Folder struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Collection is a collection in an organization vault.
+type Collection struct {
+	ID             string  `json:"id"`
+	OrganizationID *string `json:"organizationId"`
+	Name           string  `json:"name"`
+	ExternalID     *string `json:"externalId"`
+}
+
+// Item is an item in a vault. Only logins are supported.
+type Item struct {
+	ID             string   `json:"id"`
+	OrganizationID *string  `json:"organizationId"`
+	FolderID       *string  `json:"folderId"`
+	Type           int      `json:"type"`
+	Reprompt       int      `json:"reprompt"`
+	Name           string   `json:"name"`
+	Notes          *string  `json:"notes"`
+	Favorite       bool     `json:"favorite"`
+	Login          *Login   `json:"login,omitempty"`
+	CollectionIDs  []string `json:"collectionIds"`
+}
+
+// Login is the login of an Item.
+type Login struct {
+	URIs     []URI   `json:"uris"`
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+
+	// The TOTP secret, as a Key URI (otpauth://) or a base32 secret
+	TOTP *string `json:"totp"`
+}
+
+// URI is a website that a Login is for.
+type URI struct {
+	Match *int   `json:"match"`
+	URI   string `json:"uri"`
+}
+
+// NewLogin returns a login Item, with a new ID. Empty arguments are omitted.
+func NewLogin(name, username, totp, notes string) (Item, error) {
+	id, err := NewID()
+	if err != nil {
+		return Item{}, err
+	}
+	return Item{
+		ID:    id,
+		Type:  TypeLogin,
+		Name:  name,
+		Notes: optional(notes),
+		Login: &Login{
+			URIs:     []URI{},
+			Username: optional(username),
+			TOTP:     optional(totp),
+		},
+	}, nil
+}
+
+// AddToCollection adds all items to a new collection with the given name,
+// for importing into an organization.
+func (e *Export) AddToCollection(name string) error {
+	id, err := NewID()
+	if err != nil {
+		return err
+	}
+	e.Collections = append(e.Collections, Collection{ID: id, Name: name})
+	for i := range e.Items {
+		e.Items[i].CollectionIDs = append(e.Items[i].CollectionIDs, id)
+	}
+	return nil
+}
+
+// Write writes the export as plain JSON.
+func (e *Export) Write(w io.Writer) error {
+	plain := *e
+	plain.Encrypted = false
+	if plain.Items == nil {
+		plain.Items = []Item{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(plain)
+}
+
+// NewID returns a random (version 4) UUID, as Bitwarden uses for IDs.
+func NewID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", err
+	}
+	buf[6] = buf[6]&0x0f | 0x40
+	buf[8] = buf[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16]), nil
+}
+
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,116 @@
+package bitwarden
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// DefaultKDFIterations is the number of PBKDF2 iterations which Bitwarden
+// uses by default to protect exports.
+const DefaultKDFIterations = 600000
+
+// KDF types of encrypted exports
+const (
+	kdfPBKDF2 = 0
+)
+
+// encryptedExport is Bitwarden's password-protected export format. The plain
+// export is encrypted as data, and a random value as the validation, which
+// Bitwarden decrypts to check the password.
+type encryptedExport struct {
+	Encrypted         bool   `json:"encrypted"`
+	PasswordProtected bool   `json:"passwordProtected"`
+	Salt              string `json:"salt"`
+	KDFType           int    `json:"kdfType"`
+	KDFIterations     int    `json:"kdfIterations"`
+	KDFMemory         *int   `json:"kdfMemory"`
+	KDFParallelism    *int   `json:"kdfParallelism"`
+	EncKeyValidation  string `json:"encKeyValidation_DO_NOT_EDIT"`
+	Data              string `json:"data"`
+}
+
+// WriteEncrypted writes the export in Bitwarden's password-protected
+// format, with its key derived from password by PBKDF2-SHA256.
+func (e *Export) WriteEncrypted(w io.Writer, password string, iterations int) error {
+	var plain bytes.Buffer
+	if err := e.Write(&plain); err != nil {
+		return err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	out := encryptedExport{
+		Encrypted:         true,
+		PasswordProtected: true,
+		Salt:              base64.StdEncoding.EncodeToString(salt),
+		KDFType:           kdfPBKDF2,
+		KDFIterations:     iterations,
+	}
+	encKey, macKey := exportKey(password, out.Salt, iterations)
+
+	validation, err := NewID()
+	if err != nil {
+		return err
+	}
+	if out.EncKeyValidation, err = encryptString(encKey, macKey, []byte(validation)); err != nil {
+		return err
+	}
+	if out.Data, err = encryptString(encKey, macKey, bytes.TrimSpace(plain.Bytes())); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// exportKey derives the encryption and MAC keys of an export. The salt is
+// used as the base64 string itself, not the bytes that it encodes.
+func exportKey(password, salt string, iterations int) (encKey, macKey []byte) {
+	key := pbkdf2.Key([]byte(password), []byte(salt), iterations, 32, sha256.New)
+	encKey = make([]byte, 32)
+	macKey = make([]byte, 32)
+	io.ReadFull(hkdf.Expand(sha256.New, key, []byte("enc")), encKey)
+	io.ReadFull(hkdf.Expand(sha256.New, key, []byte("mac")), macKey)
+	return encKey, macKey
+}
+
+// encryptString encrypts plaintext as a Bitwarden EncString of type 2, which
+// is AES-256-CBC with an HMAC-SHA256: "2.iv|ciphertext|mac".
+func encryptString(encKey, macKey, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ct := make([]byte, len(plaintext)+padding)
+	copy(ct, plaintext)
+	for i := len(plaintext); i < len(ct); i++ {
+		ct[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, ct)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ct)
+
+	b64 := base64.StdEncoding.EncodeToString
+	return "2." + b64(iv) + "|" + b64(ct) + "|" + b64(mac.Sum(nil)), nil
+}
@@ -0,0 +1,115 @@
+package bitwarden
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+func TestWriteEncryptedRoundTrip(t *testing.T) {
+	var e Export
+	for _, k := range []struct{ name, account, uri string }{
+		{"GitHub", "alice", "otpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP&issuer=GitHub"},
+		{"Google", "bob@example.com", "otpauth://totp/Google:bob%40example.com?secret=GEZDGNBVGY3TQOJQ&digits=8&issuer=Google"},
+	} {
+		item, err := NewLogin(k.name, k.account, k.uri, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Items = append(e.Items, item)
+	}
+
+	var buf bytes.Buffer
+	if err := e.WriteEncrypted(&buf, "hunter2", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "JBSWY3DPEHPK3PXP") {
+		t.Fatal("The secret was written in the clear")
+	}
+	var enc encryptedExport
+	if err := json.Unmarshal(buf.Bytes(), &enc); err != nil {
+		t.Fatal(err)
+	}
+	if !enc.Encrypted || !enc.PasswordProtected || enc.KDFType != kdfPBKDF2 || enc.KDFIterations != 1000 {
+		t.Errorf("Unexpected encryption parameters: %+v", enc)
+	}
+
+	keys, err := Read(bytes.NewReader(buf.Bytes()), "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Secret != "JBSWY3DPEHPK3PXP" || keys[1].Secret != "GEZDGNBVGY3TQOJQ" || keys[1].Digits != 8 {
+		t.Errorf("Unexpected keys: %+v", keys)
+	}
+
+	if _, err := Read(bytes.NewReader(buf.Bytes()), "wrong"); err == nil || !strings.Contains(err.Error(), "password") {
+		t.Errorf("Expected the wrong password to be rejected, got %v", err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes()), ""); err != otpauth.ErrPasswordRequired {
+		t.Errorf("Expected a password to be required, got %v", err)
+	}
+}
+
+// testdata/encrypted.json was encrypted independently of this package, with
+// Python's hashlib and hmac and OpenSSL's AES-256-CBC, following Bitwarden's
+// format: PBKDF2-SHA256 of the password with the base64 salt string, stretched
+// by HKDF-Expand into "enc" and "mac" keys.
+func TestReadEncrypted(t *testing.T) {
+	f, err := os.Open("testdata/encrypted.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	keys, err := Read(f, "correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []otpauth.Key{
+		{Type: otpauth.TypeTOTP, Issuer: "GitHub", Account: "alice", Secret: "JBSWY3DPEHPK3PXP",
+			Algorithm: "SHA1", Digits: 6, Period: 30, Tags: []string{"Work"}},
+		{Type: otpauth.TypeTOTP, Issuer: "Google", Account: "bob@example.com", Secret: "GEZDGNBVGY3TQOJQ",
+			Algorithm: "SHA1", Digits: 6, Period: 30},
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Got %d keys, expected %d: %+v", len(keys), len(expected), keys)
+	}
+	for i := range expected {
+		got, want := keys[i], expected[i]
+		if got.Type != want.Type || got.Issuer != want.Issuer || got.Account != want.Account ||
+			got.Secret != want.Secret || got.Algorithm != want.Algorithm || got.Digits != want.Digits ||
+			got.Period != want.Period || strings.Join(got.Tags, ",") != strings.Join(want.Tags, ",") {
+			t.Errorf("Key %d: got %+v, expected %+v", i, got, want)
+		}
+	}
+}
+
+func TestDecryptStringRejectsTampering(t *testing.T) {
+	encKey, macKey := exportKey("hunter2", "c2FsdA==", 1000)
+	s, err := encryptString(encKey, macKey, []byte("otpauth://totp/GitHub?secret=JBSWY3DPEHPK3PXP"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := decryptString(encKey, macKey, s); err != nil || !strings.HasSuffix(string(plain), "JBSWY3DPEHPK3PXP") {
+		t.Fatalf("Decrypted %q, %v", plain, err)
+	}
+
+	parts := strings.Split(s, "|")
+	ct := []byte(parts[1])
+	if ct[0] == 'A' {
+		ct[0] = 'B'
+	} else {
+		ct[0] = 'A'
+	}
+	tampered := parts[0] + "|" + string(ct) + "|" + parts[2]
+	if _, err := decryptString(encKey, macKey, tampered); err == nil {
+		t.Error("Tampered ciphertext was decrypted")
+	}
+	if _, err := decryptString(encKey, macKey, "0."+s[2:]); err == nil {
+		t.Error("An unsupported encryption type was decrypted")
+	}
+}
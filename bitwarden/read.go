@@ -0,0 +1,175 @@
+package bitwarden
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+// Read reads the TOTP keys of the logins in an export, named by the item's
+// name and username, and tagged with its folder or collections. The password
+// is only needed if the export is password-protected.
+func Read(r io.Reader, password string) ([]otpauth.Key, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var enc encryptedExport
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return nil, fmt.Errorf("Failed to decode the export: %v", err)
+	}
+	if enc.Encrypted {
+		if !enc.PasswordProtected {
+			return nil, errors.New("The export is encrypted with the account key, rather than a password, " +
+				"and can only be imported by Bitwarden")
+		}
+		if password == "" {
+			return nil, otpauth.ErrPasswordRequired
+		}
+		if data, err = enc.decrypt(password); err != nil {
+			return nil, err
+		}
+	}
+
+	var e Export
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("Failed to decode the export: %v", err)
+	}
+	return e.Keys()
+}
+
+// Keys returns the TOTP keys of the logins in the export. Keys of
+// unsupported types are left out, and reported with an
+// otpauth.UnsupportedError.
+func (e *Export) Keys() ([]otpauth.Key, error) {
+	folders := map[string]string{}
+	for _, f := range e.Folders {
+		folders[f.ID] = f.Name
+	}
+	collections := map[string]string{}
+	for _, c := range e.Collections {
+		collections[c.ID] = c.Name
+	}
+
+	var keys []otpauth.Key
+	var skipped []string
+	for _, item := range e.Items {
+		if item.Login == nil || item.Login.TOTP == nil || *item.Login.TOTP == "" {
+			continue
+		}
+		var account string
+		if item.Login.Username != nil {
+			account = *item.Login.Username
+		}
+
+		totp := strings.TrimSpace(*item.Login.TOTP)
+		var k otpauth.Key
+		switch {
+		case strings.HasPrefix(totp, "otpauth://"):
+			var err error
+			k, err = otpauth.Parse(totp)
+			if uerr, ok := err.(*otpauth.UnsupportedError); ok {
+				skipped = append(skipped, uerr.Skipped...)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Item %s: %v", item.Name, err)
+			}
+		case strings.HasPrefix(totp, "steam://"):
+			k = otpauth.New(item.Name, account, strings.TrimPrefix(totp, "steam://"))
+			k.Type = otpauth.TypeSteam
+			k.Digits = 5
+		default:
+			k = otpauth.New(item.Name, account, totp)
+		}
+		if k.Issuer == "" {
+			k.Issuer = item.Name
+		}
+		if k.Account == "" {
+			k.Account = account
+		}
+
+		if item.FolderID != nil {
+			if name, ok := folders[*item.FolderID]; ok {
+				k.Tags = append(k.Tags, name)
+			}
+		}
+		for _, id := range item.CollectionIDs {
+			if name, ok := collections[id]; ok {
+				k.Tags = append(k.Tags, name)
+			}
+		}
+		keys = append(keys, k)
+	}
+	if len(skipped) > 0 {
+		return keys, &otpauth.UnsupportedError{Skipped: skipped}
+	}
+	return keys, nil
+}
+
+// decrypt checks the password against the validation, and decrypts the
+// plain export.
+func (enc encryptedExport) decrypt(password string) ([]byte, error) {
+	if enc.KDFType != kdfPBKDF2 {
+		return nil, fmt.Errorf("Unsupported KDF type %d", enc.KDFType)
+	}
+	encKey, macKey := exportKey(password, enc.Salt, enc.KDFIterations)
+	if _, err := decryptString(encKey, macKey, enc.EncKeyValidation); err != nil {
+		return nil, errors.New("The password doesn't decrypt the export")
+	}
+	return decryptString(encKey, macKey, enc.Data)
+}
+
+// decryptString decrypts an EncString of type 2, as written by
+// encryptString.
+func decryptString(encKey, macKey []byte, s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "2.") {
+		return nil, errors.New("Unsupported encryption type")
+	}
+	parts := strings.Split(s[2:], "|")
+	if len(parts) != 3 {
+		return nil, errors.New("The encrypted data is malformed")
+	}
+	var decoded [3][]byte
+	for i, p := range parts {
+		var err error
+		if decoded[i], err = base64.StdEncoding.DecodeString(p); err != nil {
+			return nil, fmt.Errorf("The encrypted data is malformed: %v", err)
+		}
+	}
+	iv, ct, sum := decoded[0], decoded[1], decoded[2]
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(iv)
+	mac.Write(ct)
+	if !hmac.Equal(mac.Sum(nil), sum) {
+		return nil, errors.New("The encrypted data failed authentication")
+	}
+	if len(iv) != aes.BlockSize || len(ct) == 0 || len(ct)%aes.BlockSize != 0 {
+		return nil, errors.New("The encrypted data is malformed")
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(ct))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ct)
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > aes.BlockSize ||
+		!bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		return nil, errors.New("The encrypted data has invalid padding")
+	}
+	return plain[:len(plain)-padding], nil
+}
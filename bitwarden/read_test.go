@@ -0,0 +1,54 @@
+package bitwarden
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+func TestRead(t *testing.T) {
+	f, err := os.Open("testdata/export.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	keys, err := Read(f, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Logins without a TOTP, and other items, are left out
+	expected := []struct {
+		uri  string
+		tags string
+	}{
+		{"otpauth://totp/GitHub:alice?digits=6&issuer=GitHub&secret=JBSWY3DPEHPK3PXP", "Work"},
+		{"otpauth://totp/Google:bob@example.com?digits=6&issuer=Google&secret=GEZDGNBVGY3TQOJQ", ""},
+		{"otpauth://steam/Steam:carol?digits=5&issuer=Steam&secret=KRUGKIDROVUWG2ZA", ""},
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Got %d keys, expected %d", len(keys), len(expected))
+	}
+	for i, k := range keys {
+		if k.URI() != expected[i].uri || strings.Join(k.Tags, ",") != expected[i].tags {
+			t.Errorf("Key %d: got %s tagged %v, expected %s tagged %q", i, k.URI(), k.Tags, expected[i].uri, expected[i].tags)
+		}
+	}
+}
+
+func TestReadSkipsUnsupported(t *testing.T) {
+	export := `{"encrypted":false,"items":[
+		{"id":"1","type":1,"name":"GitHub","login":{"username":"alice","totp":"otpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP"}},
+		{"id":"2","type":1,"name":"Yandex","login":{"username":"dave","totp":"otpauth://yandex/Yandex:dave?secret=MFRGGZDFMZTWQ2LK"}}
+	]}`
+	keys, err := Read(strings.NewReader(export), "")
+	uerr, ok := err.(*otpauth.UnsupportedError)
+	if !ok || len(uerr.Skipped) != 1 || !strings.Contains(uerr.Skipped[0], "Yandex:dave (yandex key)") {
+		t.Errorf("Expected the Yandex item to be skipped, got %v", err)
+	}
+	if len(keys) != 1 || keys[0].Issuer != "GitHub" {
+		t.Errorf("Expected the GitHub key to be read, got %+v", keys)
+	}
+}
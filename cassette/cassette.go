@@ -0,0 +1,125 @@
+// Package cassette records sessions with the Authy API to a file, and
+// replays them to an authy.Client offline.
+//
+// Secrets in recorded requests and responses (seeds, salts, keys, PINs,
+// OTPs and phone numbers) are replaced by fakes of the same format. The same
+// secret is always replaced by the same fake within a recording, so a
+// replayed session remains consistent.
+//
+//	rec := cassette.NewRecorder("session.json", nil)
+//	cl, err := authy.NewClient(authy.WithTransport(rec))
+//
+//	c, err := cassette.Load("session.json")
+//	cl, err := authy.NewClient(authy.WithTransport(cassette.NewReplayer(c)))
+package cassette
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Cassette is a recorded session with the Authy API.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a single request and the response to it.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a sanitized HTTP request.
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+// Response is a sanitized HTTP response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Load reads a cassette from a file written by a Recorder.
+func Load(path string) (*Cassette, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to a file.
+func (c *Cassette) Save(path string) error {
+	buf, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, buf, 0600)
+}
+
+// Parameters which change on every request, and so are ignored when
+// matching requests. Tokens are encrypted with a random salt and IV, so
+// their ciphertext differs each time they are uploaded. Secret parameters
+// are ignored too, since they were sanitized in the recording.
+var volatileParams = map[string]bool{
+	"encrypted_seed":     true,
+	"otp1":               true,
+	"otp2":               true,
+	"otp3":               true,
+	"password_timestamp": true,
+	"salt":               true,
+	"signature":          true,
+	"unique_iv":          true,
+}
+
+// The phone number in the user status path is sanitized, so it is ignored
+// when matching requests.
+var phonePath = regexp.MustCompile(`/users/(\d+)-(\d+)/status$`)
+
+// matchKey identifies the requests that an Interaction may be replayed for.
+func matchKey(method, rawURL, body string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return method + " " + rawURL
+	}
+	path := phonePath.ReplaceAllString(u.Path, "/users/$1-*/status")
+	key := method + " " + u.Host + path + "?" + stableParams(u.RawQuery)
+	if form, err := url.ParseQuery(body); err == nil && body != "" {
+		key += " " + stableParams(form.Encode())
+	} else if body != "" {
+		key += " " + body
+	}
+	return key
+}
+
+// stableParams drops volatile and secret parameters from the encoded query.
+func stableParams(query string) string {
+	vals, err := url.ParseQuery(query)
+	if err != nil {
+		return query
+	}
+	var parts []string
+	for k, vs := range vals {
+		if volatileParams[k] || secretParams[k] {
+			continue
+		}
+		for _, v := range vs {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
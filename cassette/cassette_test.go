@@ -0,0 +1,50 @@
+package cassette
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func tokenForm(seed, salt, iv string) string {
+	return url.Values{
+		"name":           {"GitHub"},
+		"encrypted_seed": {seed},
+		"salt":           {salt},
+		"unique_iv":      {iv},
+		"otp1":           {"1234567"},
+	}.Encode()
+}
+
+func TestMatchKeyIgnoresTokenCiphertext(t *testing.T) {
+	const u = "https://api.authy.com/json/users/1/devices/2/authenticator_tokens/abc"
+	a := matchKey("PUT", u, tokenForm("c2VlZDE=", "0011", "aabb"))
+	b := matchKey("PUT", u, tokenForm("c2VlZDI=", "2233", "ccdd"))
+	if a != b {
+		t.Errorf("Uploads of the same token don't match:\n%s\n%s", a, b)
+	}
+	if c := matchKey("PUT", u, strings.Replace(tokenForm("c2VlZDE=", "0011", "aabb"), "GitHub", "Slack", 1)); c == a {
+		t.Error("Uploads of different tokens match")
+	}
+}
+
+func TestParamsSanitizesTokenCiphertext(t *testing.T) {
+	s, err := newSanitizer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := tokenForm("c2VjcmV0IHNlZWQ=", "00112233445566778899aabbccddeeff", "0123456789abcdef0123456789abcdef")
+	vals, err := url.ParseQuery(s.params(form))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, _ := url.ParseQuery(form)
+	for _, k := range []string{"encrypted_seed", "salt", "unique_iv", "otp1"} {
+		if got, want := vals.Get(k), orig.Get(k); got == want || len(got) != len(want) {
+			t.Errorf("%s: got %q for %q, expected a fake of the same length", k, got, want)
+		}
+	}
+	if vals.Get("name") != "GitHub" {
+		t.Errorf("The name was changed to %q", vals.Get("name"))
+	}
+}
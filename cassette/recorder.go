@@ -0,0 +1,97 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// Response headers worth keeping. The Date header isn't, since replaying it
+// would make the client think its clock is skewed by the time since the
+// session was recorded.
+var recordedHeaders = []string{"Content-Type"}
+
+// Recorder is an http.RoundTripper that records sanitized interactions
+// with the Authy API to a cassette file, rewriting the file after every
+// interaction.
+type Recorder struct {
+	path string
+	rt   http.RoundTripper
+
+	mu       sync.Mutex
+	san      *sanitizer
+	cassette Cassette
+}
+
+// NewRecorder creates a Recorder that sends requests via rt (or
+// http.DefaultTransport if nil), and records them to the file at path.
+func NewRecorder(path string, rt http.RoundTripper) *Recorder {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &Recorder{path: path, rt: rt}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := r.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	if err := r.record(req, reqBody, resp, respBody); err != nil {
+		return nil, fmt.Errorf("cassette: failed to record interaction: %v", err)
+	}
+	return resp, nil
+}
+
+func (r *Recorder) record(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.san == nil {
+		san, err := newSanitizer()
+		if err != nil {
+			return err
+		}
+		r.san = san
+	}
+
+	in := Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    r.san.url(req.URL.String()),
+			Body:   r.san.params(string(reqBody)),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     http.Header{},
+			Body:       r.san.body(string(respBody)),
+		},
+	}
+	for _, h := range recordedHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			in.Response.Header.Set(h, v)
+		}
+	}
+	r.cassette.Interactions = append(r.cassette.Interactions, in)
+	return r.cassette.Save(r.path)
+}
@@ -0,0 +1,171 @@
+package cassette_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexzorin/authy"
+	"github.com/alexzorin/authy/cassette"
+)
+
+// Secrets sent and returned by the server in the recorded session
+const (
+	phone         = "5551234"
+	pin           = "246810"
+	deviceSeed    = "8f0e4ad2c6b1a3957d2e4f6081b9c3a5d7e9f1031527394b5d6f8091a2b3c4d5"
+	encryptedSeed = "cGxlYXNlIGRvbid0IHJlY29yZCBtZSwgSSdtIGEgc2VlZA=="
+	salt          = "Zb7TKWQC8fPXaf0E1xNCQpL3"
+	uniqueIV      = "00112233445566778899aabbccddeeff"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// server answers like the Authy API, with a clock two hours ahead.
+func server(t *testing.T) http.RoundTripper {
+	return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var body string
+		switch {
+		case req.Method == http.MethodHead:
+		case strings.HasSuffix(req.URL.Path, "/users/1-"+phone+"/status"):
+			body = `{"authy_id":123,"devices_count":1,"message":"active","success":true}`
+		case strings.HasSuffix(req.URL.Path, "/users/123/devices/registration/complete"):
+			buf, _ := ioutil.ReadAll(req.Body)
+			if !strings.Contains(string(buf), "pin="+pin) {
+				t.Errorf("The PIN wasn't sent: %s", buf)
+			}
+			body = `{"authy_id":123,"device":{"id":77,"secret_seed":"` + deviceSeed + `"}}`
+		case strings.HasSuffix(req.URL.Path, "/users/123/authenticator_tokens"):
+			body = `{"authenticator_tokens":[{"name":"GitHub","account_type":"github","digits":6,` +
+				`"encrypted_seed":"` + encryptedSeed + `","salt":"` + salt + `","unique_iv":"` + uniqueIV + `",` +
+				`"key_derivation_iterations":100000,"unique_id":"1001"}],"deleted":[],"success":true}`
+		default:
+			t.Errorf("Unexpected request %s %s", req.Method, req.URL)
+		}
+		h := http.Header{}
+		h.Set("Content-Type", "application/json")
+		h.Set("Date", time.Now().Add(2*time.Hour).UTC().Format(http.TimeFormat))
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     h,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    req,
+		}, nil
+	})
+}
+
+// session makes the requests of the recorded session, at the local time now.
+func session(t *testing.T, rt http.RoundTripper, now time.Time) (*authy.Client, authy.CompleteDeviceRegistrationResponse, authy.AuthenticatorTokensResponse) {
+	cl, err := authy.NewClient(authy.WithTransport(rt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if us, err := cl.QueryUser(ctx, 1, phone); err != nil || us.AuthyID != 123 {
+		t.Fatalf("QueryUser: %+v, %v", us, err)
+	}
+	device, err := cl.CompleteDeviceRegistration(ctx, 123, pin)
+	if err != nil {
+		t.Fatalf("CompleteDeviceRegistration: %v", err)
+	}
+	toks, err := cl.QueryAuthenticatorTokens(ctx, 123, 77, deviceSeed)
+	if err != nil || len(toks.AuthenticatorTokens) != 1 {
+		t.Fatalf("QueryAuthenticatorTokens: %+v, %v", toks, err)
+	}
+	return cl, device, toks
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.json")
+	recorded := time.Now()
+	_, device, toks := session(t, cassette.NewRecorder(path, server(t)), recorded)
+	if device.Device.SecretSeed != deviceSeed || toks.AuthenticatorTokens[0].Salt != salt {
+		t.Fatal("The recorder changed the responses passed to the client")
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{phone, pin, deviceSeed, encryptedSeed, salt, uniqueIV} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("The cassette contains the secret %q", secret)
+		}
+	}
+	if strings.Contains(string(raw), "Date") {
+		t.Error("The cassette contains the Date header")
+	}
+
+	// Replay an hour later, so that the OTPs differ
+	c, err := cassette.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The clock was measured from the first response, so it wasn't synced
+	// with a HEAD request, which the replayer answers anyway
+	if len(c.Interactions) != 3 {
+		t.Errorf("Recorded %d interactions, expected 3", len(c.Interactions))
+	}
+	replayed := recorded.Add(time.Hour)
+	cl, replayDevice, replayToks := session(t, cassette.NewReplayer(c), replayed)
+
+	// The responses are sanitized consistently, keeping their format
+	if got := replayDevice.Device.SecretSeed; got == deviceSeed || len(got) != len(deviceSeed) {
+		t.Errorf("Replayed device seed %q, expected a fake of %q", got, deviceSeed)
+	}
+	tok := replayToks.AuthenticatorTokens[0]
+	if tok.Name != "GitHub" || tok.UniqueID != "1001" || tok.KDFRounds != 100000 {
+		t.Errorf("Replayed token %+v doesn't match the recording", tok)
+	}
+	if tok.EncryptedSeed == encryptedSeed || len(tok.EncryptedSeed) != len(encryptedSeed) ||
+		tok.Salt == salt || len(tok.Salt) != len(salt) || tok.UniqueIV == uniqueIV || len(tok.UniqueIV) != len(uniqueIV) {
+		t.Errorf("Replayed token %+v isn't sanitized", tok)
+	}
+
+	// The recorded server time isn't replayed
+	if offset, measured := cl.ClockSkew(); measured {
+		t.Errorf("The replayed session measured a clock skew of %v", offset)
+	}
+
+	// Requests that weren't recorded fail
+	if _, err := cl.QueryAuthenticatorApps(context.Background(), 123, 77, deviceSeed); err == nil ||
+		!strings.Contains(err.Error(), "no recorded interaction") {
+		t.Errorf("Expected an unrecorded request to fail, got %v", err)
+	}
+}
+
+func TestReplayDropsRecordedDate(t *testing.T) {
+	c := &cassette.Cassette{Interactions: []cassette.Interaction{{
+		Request: cassette.Request{Method: http.MethodHead, URL: "https://api.authy.com/json/"},
+		Response: cassette.Response{StatusCode: http.StatusOK, Header: http.Header{
+			"Date":         {"Mon, 02 Jan 2006 15:04:05 GMT"},
+			"Content-Type": {"application/json"},
+		}},
+	}}}
+	cl, err := authy.NewClient(authy.WithTransport(cassette.NewReplayer(c)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.SyncClock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if offset, measured := cl.ClockSkew(); measured {
+		t.Errorf("The recorded Date header was replayed, measuring a skew of %v", offset)
+	}
+}
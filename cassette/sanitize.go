@@ -0,0 +1,225 @@
+package cassette
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Response fields which hold secrets
+var secretFields = map[string]bool{
+	"api_key":        true,
+	"approval_pin":   true,
+	"encrypted_seed": true,
+	"pin":            true,
+	"private_key":    true,
+	"salt":           true,
+	"secret_seed":    true,
+	"unique_iv":      true,
+}
+
+// Request parameters which hold secrets. The api_key parameter is not
+// included, since it is the well-known key of the Authy apps. Uploaded
+// tokens are sanitized like the fields of the responses.
+var secretParams = map[string]bool{
+	"encrypted_seed": true,
+	"otp1":           true,
+	"otp2":           true,
+	"otp3":           true,
+	"pin":            true,
+	"salt":           true,
+	"signature":      true,
+	"unique_iv":      true,
+}
+
+// sanitizer replaces secrets with fakes of the same format. Fakes are
+// derived from the secret with a key that is never persisted, so that the
+// same secret always gets the same fake during a recording.
+type sanitizer struct {
+	key []byte
+
+	mu   sync.Mutex
+	pems map[string]string
+}
+
+func newSanitizer() (*sanitizer, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &sanitizer{key: key, pems: map[string]string{}}, nil
+}
+
+// stream returns n pseudorandom bytes derived from value.
+func (s *sanitizer) stream(value string, n int) []byte {
+	var out []byte
+	ctr := make([]byte, 4)
+	for i := uint32(0); len(out) < n; i++ {
+		binary.BigEndian.PutUint32(ctr, i)
+		mac := hmac.New(sha256.New, s.key)
+		mac.Write(ctr)
+		mac.Write([]byte(value))
+		out = mac.Sum(out)
+	}
+	return out[:n]
+}
+
+// fake returns a fake for the secret value, with the same length and
+// format.
+func (s *sanitizer) fake(value string) string {
+	switch {
+	case value == "":
+		return ""
+	case strings.Contains(value, "PRIVATE KEY"):
+		return s.fakePEM(value)
+	case isDigits(value):
+		out := []byte(value)
+		for i, r := range s.stream(value, len(value)) {
+			out[i] = '0' + r%10
+		}
+		return string(out)
+	case isHex(value):
+		out := hex.EncodeToString(s.stream(value, len(value)/2))
+		if value == strings.ToUpper(value) {
+			out = strings.ToUpper(out)
+		}
+		return out
+	}
+	if raw, err := base64.StdEncoding.DecodeString(value); err == nil {
+		return base64.StdEncoding.EncodeToString(s.stream(value, len(raw)))
+	}
+
+	out := []byte(value)
+	for i, r := range s.stream(value, len(value)) {
+		c := out[i]
+		switch {
+		case c >= '0' && c <= '9':
+			out[i] = '0' + r%10
+		case c >= 'a' && c <= 'z':
+			out[i] = 'a' + r%26
+		case c >= 'A' && c <= 'Z':
+			out[i] = 'A' + r%26
+		}
+	}
+	return string(out)
+}
+
+// fakePEM replaces a private key with a freshly generated one, so that the
+// replayed key still parses.
+func (s *sanitizer) fakePEM(value string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fake, ok := s.pems[value]; ok {
+		return fake
+	}
+	pk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "REDACTED"
+	}
+	fake := string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(pk),
+	}))
+	s.pems[value] = fake
+	return fake
+}
+
+func isHex(s string) bool {
+	if len(s)%2 != 0 {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// url sanitizes the secret query parameters and the phone number of a
+// request URL.
+func (s *sanitizer) url(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	u.Path = phonePath.ReplaceAllStringFunc(u.Path, func(m string) string {
+		parts := phonePath.FindStringSubmatch(m)
+		return "/users/" + parts[1] + "-" + s.fake(parts[2]) + "/status"
+	})
+	u.RawQuery = s.params(u.RawQuery)
+	return u.String()
+}
+
+// params sanitizes secret parameters of a URL-encoded query or form.
+func (s *sanitizer) params(query string) string {
+	vals, err := url.ParseQuery(query)
+	if err != nil || query == "" {
+		return query
+	}
+	for k, vs := range vals {
+		if !secretParams[k] {
+			continue
+		}
+		for i := range vs {
+			vs[i] = s.fake(vs[i])
+		}
+	}
+	return vals.Encode()
+}
+
+// body sanitizes the secret fields of a JSON response body.
+func (s *sanitizer) body(body string) string {
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return body
+	}
+	buf, err := json.Marshal(s.walk(v, false))
+	if err != nil {
+		return body
+	}
+	return string(buf)
+}
+
+func (s *sanitizer) walk(v interface{}, secret bool) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			v[k] = s.walk(val, secretFields[k])
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = s.walk(v[i], secret)
+		}
+	case string:
+		if secret {
+			return s.fake(v)
+		}
+	case json.Number:
+		if secret {
+			return json.Number(s.fake(v.String()))
+		}
+	}
+	return v
+}
@@ -0,0 +1,123 @@
+package authy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// The Date header only has a resolution of one second, so offsets smaller
+// than this can't be distinguished from a correct clock.
+const minClockSkew = time.Second
+
+// clockSkew tracks the estimated offset between the Authy server's clock
+// and the local clock, measured from the Date header of API responses.
+type clockSkew struct {
+	mu       sync.Mutex
+	offset   time.Duration
+	measured bool
+
+	// Whether the clock has been synced, even if the server's response
+	// had no Date header to measure the offset from
+	synced bool
+}
+
+// observe updates the offset estimate from resp, which was requested at
+// sent and received at received (both local time).
+func (s *clockSkew) observe(resp *http.Response, sent, received time.Time) {
+	if resp == nil {
+		return
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	// The server truncates to the second, so on average it is half a second
+	// ahead of the header. Assume it stamped the response halfway through
+	// the round trip.
+	server := date.Add(500 * time.Millisecond)
+	local := sent.Add(received.Sub(sent) / 2)
+
+	offset := server.Sub(local)
+	if offset < minClockSkew && offset > -minClockSkew {
+		offset = 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset = offset
+	s.measured = true
+	s.synced = true
+}
+
+func (s *clockSkew) get() (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset, s.measured
+}
+
+// markSynced records that the clock was synced, so that it isn't synced
+// again before every request when the server doesn't send its time.
+func (s *clockSkew) markSynced() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.synced = true
+}
+
+func (s *clockSkew) isSynced() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.synced
+}
+
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// ClockSkew reports the estimated offset of the Authy server's clock
+// relative to the local clock (positive when the server is ahead), and
+// whether it has been measured yet. It is corrected for automatically when
+// generating device OTPs.
+func (c *Client) ClockSkew() (time.Duration, bool) {
+	return c.skew.get()
+}
+
+// SyncClock measures the clock skew against the Authy API. It is called
+// automatically before the first OTP-authenticated request, but may be
+// called again to refresh the estimate. If the server doesn't send its time,
+// the local clock is trusted, and ClockSkew reports that it wasn't measured.
+func (c *Client) SyncClock(ctx context.Context) error {
+	req, err := http.NewRequest(http.MethodHead, baseURL, nil)
+	if err != nil {
+		return err
+	}
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+	}
+
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.skew.markSynced()
+	return nil
+}
+
+// otpTime returns the current time according to the Authy server,
+// measuring the clock skew first if that hasn't been tried yet.
+func (c *Client) otpTime(ctx context.Context) (time.Time, error) {
+	if !c.skew.isSynced() {
+		if err := c.SyncClock(ctx); err != nil {
+			return time.Time{}, err
+		}
+	}
+	offset, _ := c.skew.get()
+	return c.now().Add(offset), nil
+}
@@ -0,0 +1,156 @@
+package authy
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc serves requests with a function, instead of the network.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func dateResponse(date time.Time) *http.Response {
+	h := http.Header{}
+	h.Set("Date", date.UTC().Format(http.TimeFormat))
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     h,
+		Body:       ioutil.NopCloser(strings.NewReader("{}")),
+	}
+}
+
+func TestObserve(t *testing.T) {
+	sent := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		date     time.Time
+		rtt      time.Duration
+		expected time.Duration
+	}{
+		// The Date header is truncated, so the server is assumed to be half
+		// a second ahead of it, and the response stamped mid-way
+		{"server ahead", sent.Add(10 * time.Second), time.Second, 10 * time.Second},
+		{"server behind", sent.Add(-10 * time.Second), time.Second, -10 * time.Second},
+		{"in sync", sent, time.Second, 0},
+		{"dead zone ahead", sent, 200 * time.Millisecond, 0},
+		{"dead zone behind", sent.Add(-time.Second), 800 * time.Millisecond, 0},
+		{"edge of dead zone ahead", sent.Add(time.Second), time.Second, time.Second},
+		{"edge of dead zone behind", sent.Add(-time.Second), time.Second, -time.Second},
+	}
+	for _, tt := range tests {
+		var s clockSkew
+		s.observe(dateResponse(tt.date), sent, sent.Add(tt.rtt))
+		offset, measured := s.get()
+		if !measured || offset != tt.expected {
+			t.Errorf("%s: got offset %v (measured %t), expected %v", tt.name, offset, measured, tt.expected)
+		}
+	}
+}
+
+func TestObserveWithoutDate(t *testing.T) {
+	var s clockSkew
+	s.observe(nil, time.Now(), time.Now())
+	s.observe(&http.Response{Header: http.Header{}}, time.Now(), time.Now())
+	s.observe(&http.Response{Header: http.Header{"Date": {"yesterday"}}}, time.Now(), time.Now())
+	if _, measured := s.get(); measured {
+		t.Error("A response without a valid Date header was measured")
+	}
+}
+
+// skewedClient returns a Client whose local clock is fixed at local, talking
+// to a server whose clock reads server, and a count of the requests sent.
+func skewedClient(t *testing.T, local, server time.Time) (*Client, *int) {
+	var requests int
+	cl, err := NewClient(WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		if req.Method != http.MethodHead || req.URL.String() != baseURL {
+			t.Errorf("Unexpected request %s %s", req.Method, req.URL)
+		}
+		return dateResponse(server), nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.Now = func() time.Time { return local }
+	return cl, &requests
+}
+
+func TestSyncClock(t *testing.T) {
+	local := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	cl, requests := skewedClient(t, local, local.Add(-90*time.Second))
+
+	if _, measured := cl.ClockSkew(); measured {
+		t.Fatal("The clock skew was measured before syncing")
+	}
+	if err := cl.SyncClock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// The round trip takes no time on the fixed clock, so the server is
+	// half a second ahead of its Date header
+	offset, measured := cl.ClockSkew()
+	if expected := -90*time.Second + 500*time.Millisecond; !measured || offset != expected {
+		t.Errorf("Got offset %v (measured %t), expected %v", offset, measured, expected)
+	}
+	if *requests != 1 {
+		t.Errorf("Sent %d requests, expected 1", *requests)
+	}
+}
+
+func TestOTPTime(t *testing.T) {
+	local := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	server := local.Add(2 * time.Minute)
+	cl, requests := skewedClient(t, local, server)
+
+	for i := 0; i < 2; i++ {
+		got, err := cl.otpTime(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := server.Add(500 * time.Millisecond); !got.Equal(expected) {
+			t.Errorf("Got OTP time %v, expected %v", got, expected)
+		}
+	}
+	// The skew is only measured before the first OTP
+	if *requests != 1 {
+		t.Errorf("Sent %d requests, expected 1", *requests)
+	}
+}
+
+func TestOTPTimeWithoutDate(t *testing.T) {
+	local := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	var requests int
+	cl, err := NewClient(WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		resp := dateResponse(local)
+		resp.Header.Del("Date")
+		return resp, nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.Now = func() time.Time { return local }
+
+	for i := 0; i < 2; i++ {
+		got, err := cl.otpTime(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(local) {
+			t.Errorf("Got OTP time %v, expected the local time %v", got, local)
+		}
+	}
+	// The sync is only attempted once, even though it measured nothing
+	if requests != 1 {
+		t.Errorf("Sent %d requests, expected 1", requests)
+	}
+	if _, measured := cl.ClockSkew(); measured {
+		t.Error("The clock skew was measured without a Date header")
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alexzorin/authy"
+)
+
+// backup holds the encrypted tokens and apps of a user, as saved by --save.
+type backup struct {
+	Tokens authy.AuthenticatorTokensResponse `json:"tokens"`
+	Apps   authy.AuthenticatorAppsResponse   `json:"apps"`
+}
+
+// readBackup reads a backup saved by --save.
+func readBackup(path string) (backup, error) {
+	var b backup
+	f, err := os.Open(path)
+	if err != nil {
+		return b, err
+	}
+	defer f.Close()
+	err = json.NewDecoder(f).Decode(&b)
+	return b, err
+}
+
+// writeBackup saves a backup, which only the user may read, as the apps'
+// secrets aren't encrypted.
+func writeBackup(path string, b backup) error {
+	return writeJSON(path, b)
+}
+
+// writeJSON writes v to path, replacing it with a new file that only the
+// user may read, whatever the permissions of the file it replaces. The new
+// file is written in full before it replaces the old one, so an
+// interrupted write leaves the old one intact.
+func writeJSON(path string, v interface{}) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(v); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// cache is the backup kept by --cached. Unlike a backup saved by --save,
+// the apps' secrets are encrypted with the backup password, like those of
+// the tokens, so the cache is no more sensitive than the server's copy.
+type cache struct {
+	backup
+
+	// The apps' secrets, by app ID, encrypted as tokens are. The apps
+	// themselves have no SecretSeed.
+	AppSeeds map[string]authy.AuthenticatorToken `json:"app_seeds"`
+}
+
+// newCache encrypts the apps' secrets in b with the backup password pp.
+func newCache(b backup, pp []byte) cache {
+	c := cache{backup: b, AppSeeds: map[string]authy.AuthenticatorToken{}}
+	encrypt := func(apps []authy.AuthenticatorApp) []authy.AuthenticatorApp {
+		out := make([]authy.AuthenticatorApp, len(apps))
+		for i, app := range apps {
+			// A secret which can't be encrypted is invalid anyway, so it's
+			// left out, and the app is reported as invalid when it's read
+			if seed, err := app.Token(); err == nil {
+				var tok authy.AuthenticatorToken
+				if err := tok.Encrypt(seed, string(pp)); err == nil {
+					c.AppSeeds[app.ID] = tok
+				}
+			}
+			app.SecretSeed = ""
+			out[i] = app
+		}
+		return out
+	}
+	c.Apps.AuthenticatorApps = encrypt(b.Apps.AuthenticatorApps)
+	c.Apps.Deleted = encrypt(b.Apps.Deleted)
+	return c
+}
+
+// readCache reads the cache kept by --cached.
+func readCache(path string) (cache, error) {
+	var c cache
+	f, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+	err = json.NewDecoder(f).Decode(&c)
+	return c, err
+}
+
+// decrypt returns the backup in the cache, with the apps' secrets decrypted
+// with the backup password pp.
+func (c cache) decrypt(pp []byte) (backup, error) {
+	b := c.backup
+	decrypt := func(apps []authy.AuthenticatorApp) ([]authy.AuthenticatorApp, error) {
+		out := make([]authy.AuthenticatorApp, len(apps))
+		for i, app := range apps {
+			if tok, ok := c.AppSeeds[app.ID]; ok {
+				seed, err := tok.Decrypt(string(pp))
+				if err != nil {
+					return nil, fmt.Errorf("Failed to decrypt the secret of %s: %v", app.Name, err)
+				}
+				raw, err := authy.DecodeSecret(seed)
+				if err != nil {
+					return nil, fmt.Errorf("Failed to decrypt the secret of %s: %v", app.Name, err)
+				}
+				app.SecretSeed = hex.EncodeToString(raw)
+			}
+			out[i] = app
+		}
+		return out, nil
+	}
+	var err error
+	if b.Apps.AuthenticatorApps, err = decrypt(c.Apps.AuthenticatorApps); err != nil {
+		return b, err
+	}
+	if b.Apps.Deleted, err = decrypt(c.Apps.Deleted); err != nil {
+		return b, err
+	}
+	return b, nil
+}
+
+// fetchBackup fetches the tokens and apps from the server.
+func fetchBackup() backup {
+	regr, cl := deviceClient()
+	return backup{
+		Apps:   fetchApps(cl, regr),
+		Tokens: fetchTokens(cl, regr),
+	}
+}
+
+// cachePath is where --cached keeps the tokens, next to the device
+// registration.
+func cachePath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "authy-go-cache.json"), nil
+}
+
+// accountFlags defines the flags which choose where a command's accounts
+// are loaded from, and which of them are kept, on fs. The returned function
+// loads and decrypts the accounts once fs has been parsed.
+func accountFlags(fs *flag.FlagSet) func() []entry {
+	loadPtr := fs.String("load", "", "Load tokens from this JSON file, saved with --save, instead of the server")
+	cachedPtr := fs.Bool("cached", false, "Use the tokens cached by an earlier --cached run, rather than fetching them from the server every time. "+
+		"The cache is encrypted with your backup password, and only you can read it")
+	refreshPtr := fs.Bool("refresh", false, "Fetch the tokens from the server again, and update the cache used by --cached")
+	issuersPtr := fs.String("issuers", "", "JSON file mapping Authy account types to issuer names, overriding the built-in ones")
+	overridesPtr := fs.String("overrides", "", "YAML or JSON file of overrides to rename, re-issue, tag or skip tokens")
+	buildFilter := filterFlags(fs)
+
+	return func() []entry {
+		filt, err := buildFilter()
+		if err != nil {
+			log.Fatal(err)
+		}
+		issuers := loadIssuers(*issuersPtr)
+		var overrides []override
+		if *overridesPtr != "" {
+			if overrides, err = readOverrides(*overridesPtr); err != nil {
+				log.Fatalf("Failed to read the overrides file: %v", err)
+			}
+		}
+
+		var b backup
+		var pp []byte
+		switch {
+		case *loadPtr != "":
+			if b, err = readBackup(*loadPtr); err != nil {
+				log.Fatalf("Failed to read the file: %v", err)
+			}
+		case *cachedPtr || *refreshPtr:
+			path, err := cachePath()
+			if err != nil {
+				log.Fatalf("Could not find the cache: %v", err)
+			}
+			// The password encrypts the apps' secrets in the cache
+			pp = readBackupPassword()
+			var c cache
+			if !*refreshPtr {
+				c, err = readCache(path)
+			}
+			if *refreshPtr || os.IsNotExist(err) {
+				b = fetchBackup()
+				if err := writeJSON(path, newCache(b, pp)); err != nil {
+					log.Fatalf("Failed to cache the tokens: %v", err)
+				}
+				log.Printf("Cached the tokens in %s", path)
+			} else if err != nil {
+				log.Fatalf("Failed to read the cached tokens: %v", err)
+			} else if b, err = c.decrypt(pp); err != nil {
+				log.Fatalf("%v, check your backup password or use --refresh to cache the tokens again", err)
+			}
+		default:
+			b = fetchBackup()
+		}
+
+		if pp == nil {
+			pp = readBackupPassword()
+		}
+		entries := collectEntries(b.Tokens, b.Apps, pp, issuers, filt.onlyDeleted)
+		entries = applyOverrides(entries, overrides)
+		return filt.apply(entries)
+	}
+}
+
+// fuzzyMatch reports whether the letters of pattern appear in s in order,
+// ignoring case.
+func fuzzyMatch(pattern, s string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy"
+)
+
+func TestCacheRoundTrip(t *testing.T) {
+	b := testBackup(t)
+	b.Apps.AuthenticatorApps = append(b.Apps.AuthenticatorApps, authy.AuthenticatorApp{ID: "app3", Name: "Broken", SecretSeed: "not hex"})
+	filename, cleanup := writeTemp(t, "cache.json", "")
+	defer cleanup()
+
+	c := newCache(b, []byte(testPassword))
+	if err := writeJSON(filename, c); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(buf), testAppSeed) {
+		t.Errorf("The cache contains an app's secret: %s", buf)
+	}
+	if b.Apps.AuthenticatorApps[0].SecretSeed != testAppSeed {
+		t.Error("Caching the backup modified it")
+	}
+
+	read, err := readCache(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := read.decrypt([]byte(testPassword))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The broken secret is left out
+	b.Apps.AuthenticatorApps[1].SecretSeed = ""
+	if !reflect.DeepEqual(got, b) {
+		t.Errorf("Read the cache back as %+v, expected %+v", got, b)
+	}
+
+	if _, err := read.decrypt([]byte("wrong password")); err == nil || !strings.Contains(err.Error(), "Failed to decrypt the secret of Twitch") {
+		t.Errorf("Expected the wrong password to fail, got %v", err)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	filename, cleanup := writeTemp(t, "backup.json", "old contents, which anyone can read")
+	defer cleanup()
+	if err := os.Chmod(filename, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := testBackup(t)
+	if err := writeBackup(filename, b); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0600 {
+		t.Errorf("The backup has the permissions %v, expected only the user to be able to read it", perm)
+	}
+	read, err := readBackup(filename)
+	if err != nil || !reflect.DeepEqual(read, b) {
+		t.Errorf("Read the backup back as %+v, %v", read, err)
+	}
+
+	// Nothing is left behind
+	entries, err := ioutil.ReadDir(filepath.Dir(filename))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected only the backup in its directory, got %v, %v", entries, err)
+	}
+
+	// A failed write leaves the file as it was
+	if err := writeJSON(filename, func() {}); err == nil {
+		t.Error("Wrote a value that can't be encoded")
+	}
+	if read, err := readBackup(filename); err != nil || !reflect.DeepEqual(read, b) {
+		t.Errorf("The failed write changed the backup to %+v, %v", read, err)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Dir(filename)); len(entries) != 1 {
+		t.Errorf("The failed write left %d files", len(entries))
+	}
+}
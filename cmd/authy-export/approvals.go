@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alexzorin/authy"
+)
+
+// approvalsCommand lists the pending push authentication requests for the
+// device, and approves or denies them.
+func approvalsCommand(args []string) {
+	fs := flag.NewFlagSet("approvals", flag.ExitOnError)
+	approvePtr := fs.String("approve", "", "Approve the request with this UUID")
+	denyPtr := fs.String("deny", "", "Deny the request with this UUID")
+	interactivePtr := fs.Bool("interactive", false, "Prompt to approve or deny each pending request")
+	applyClientFlags := clientFlags(fs)
+	fs.Parse(args)
+	applyClientFlags()
+
+	if *approvePtr != "" && *denyPtr != "" {
+		log.Fatal("Only one of --approve and --deny may be used")
+	}
+
+	regr, cl := deviceClient()
+
+	if *approvePtr != "" || *denyPtr != "" {
+		uuid, approve := *approvePtr, true
+		if *denyPtr != "" {
+			uuid, approve = *denyPtr, false
+		}
+		respondApproval(cl, regr, uuid, approve)
+		return
+	}
+
+	resp, err := cl.QueryApprovalRequests(nil, regr.UserID, regr.DeviceID, regr.Seed)
+	if err != nil {
+		log.Fatalf("Could not fetch approval requests: %v", err)
+	}
+	if !resp.Success {
+		log.Fatalf("Failed to fetch approval requests: %+v", resp)
+	}
+
+	var pending []authy.ApprovalRequest
+	for _, r := range resp.ApprovalRequests {
+		if r.IsPending(time.Now()) {
+			pending = append(pending, r)
+		}
+	}
+	if len(pending) == 0 {
+		log.Println("There are no pending approval requests")
+		return
+	}
+
+	sc := bufio.NewScanner(os.Stdin)
+	for _, r := range pending {
+		printApprovalRequest(r)
+		if !*interactivePtr {
+			continue
+		}
+
+		fmt.Print("Approve this request? [y]es/[n]o/[s]kip: ")
+		if !sc.Scan() {
+			return
+		}
+		switch strings.ToLower(strings.TrimSpace(sc.Text())) {
+		case "y", "yes":
+			respondApproval(cl, regr, r.UUID, true)
+		case "n", "no":
+			respondApproval(cl, regr, r.UUID, false)
+		default:
+			log.Printf("Skipped %s", r.UUID)
+		}
+	}
+}
+
+func printApprovalRequest(r authy.ApprovalRequest) {
+	fmt.Printf("\n%s\n", r.UUID)
+	fmt.Printf("  Service:  %s\n", r.AppName)
+	fmt.Printf("  Message:  %s\n", r.Message)
+	if loc := r.Location(); loc != "" {
+		fmt.Printf("  Location: %s\n", loc)
+	}
+	if r.ExpiresAt > 0 {
+		exp := time.Unix(r.ExpiresAt, 0)
+		fmt.Printf("  Expires:  %s (in %s)\n", exp.Format(time.RFC1123), time.Until(exp).Truncate(time.Second))
+	}
+
+	var keys []string
+	for k := range r.Details {
+		if !strings.EqualFold(k, "location") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  %s: %s\n", k, r.Details[k])
+	}
+}
+
+func respondApproval(cl *authy.Client, regr deviceRegistration, uuid string, approve bool) {
+	pk, err := authy.ParsePrivateKey(regr.PrivateKey)
+	if err != nil {
+		log.Fatalf("The device private key, which is needed to sign the response, is not available: %v", err)
+	}
+	resp, err := cl.RespondApprovalRequest(nil, regr.UserID, regr.DeviceID, regr.Seed, pk, uuid, approve)
+	if err != nil {
+		log.Fatalf("Could not respond to approval request %s: %v", uuid, err)
+	}
+	if !resp.Success {
+		log.Fatalf("Failed to respond to approval request %s: %+v", uuid, resp)
+	}
+	if approve {
+		log.Printf("Approved %s", uuid)
+	} else {
+		log.Printf("Denied %s", uuid)
+	}
+}
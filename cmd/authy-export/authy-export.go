@@ -1,285 +1,206 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
-	"errors"
 	"flag"
-	"fmt"
 	"log"
-	"net/url"
 	"os"
-	"path/filepath"
-	"strconv"
-	"strings"
-	"time"
 
 	"github.com/alexzorin/authy"
-	"golang.org/x/crypto/ssh/terminal"
 )
 
-// We'll persist this to the filesystem so we don't need to
-// re-register the device every time
-type deviceRegistration struct {
-	UserID   uint64 `json:"user_id,omitempty"`
-	DeviceID uint64 `json:"device_id,omitempty"`
-	Seed     string `json:"seed,omitempty"`
-	APIKey   string `json:"api_key,omitempty"`
-}
-
 func main() {
+	// Commands other than the export are named by the first argument
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	savePtr := flag.String("save", "", "Save encrypted tokens to this JSON file")
 	loadPtr := flag.String("load", "", "Load tokens from this JSON file instead of the server")
+	importPtr := flag.String("import", "", "Export the tokens from another app's backup file instead of Authy")
+	importFormatPtr := flag.String("import-format", "otpauth", "Format of the --import file: "+importFormatNames())
+	issuersPtr := flag.String("issuers", "", "JSON file mapping Authy account types to issuer names, overriding the built-in ones")
+	overridesPtr := flag.String("overrides", "", "YAML or JSON file of overrides to rename, re-issue, tag or skip tokens")
+	appsJSONPtr := flag.String("apps-json", "", "Write metadata (but not secrets) of Authy Apps to this JSON file")
+	includeDeletedPtr := flag.Bool("include-deleted", false, "Also export recently deleted tokens, labelled as deleted")
+	formatPtr := flag.String("format", "uri", "Output format: uri (one Key URI per line), json, kdbx, bitwarden, 2fas or ente")
+	outPtr := flag.String("out", "", "Write the exported tokens to this file instead of stdout")
+	flag.BoolVar(&encryptExport, "encrypt", false, "Password-protect the export, for formats which support it (bitwarden, 2fas)")
+	flag.StringVar(&bitwardenCollection, "bitwarden-collection", "", "Add the bitwarden items to a new collection with this name, for importing into an organization")
+	flag.StringVar(&kdbxKeyFile, "kdbx-key-file", "", "KeePass key file to protect the kdbx database with, in addition to or instead of a password")
+	selectPtr := flag.Bool("select", false, "Interactively choose which tokens to export")
+	buildFilter := filterFlags(flag.CommandLine)
+	applyClientFlags := clientFlags(flag.CommandLine)
 	flag.Parse()
+	applyClientFlags()
 
-	var resp struct {
-		Tokens authy.AuthenticatorTokensResponse `json:"tokens"`
-		Apps   authy.AuthenticatorAppsResponse   `json:"apps"`
+	filt, err := buildFilter()
+	if err != nil {
+		log.Fatal(err)
 	}
-	if *loadPtr != "" {
-		// Get tokens from the json file
-		f, err := os.Open(*loadPtr)
-		if err != nil {
-			log.Fatalf("Failed to read the file: %v", err)
-		}
-		defer f.Close()
+	includeDeleted := *includeDeletedPtr || filt.onlyDeleted
 
-		err = json.NewDecoder(f).Decode(&resp)
-		if err != nil {
-			log.Fatalf("Failed to decode the file: %v", err)
-		}
-	} else {
-		// Get tokens from the server
-		// If we don't already have a registered device, prompt the user for one
-		regr, err := loadExistingDeviceRegistration()
-		if err == nil {
-			log.Println("Found existing device registration")
-		} else if os.IsNotExist(err) {
-			log.Println("No existing device registration found, will perform registration now")
-			regr, err = newInteractiveDeviceRegistration()
-			if err != nil {
-				log.Fatalf("Device registration failed: %v", err)
-			}
-		} else if err != nil {
-			log.Fatalf("Could not check for existing device registration: %v", err)
-		}
-
-		// By now we have a valid user and device ID
-		log.Printf("Authy User ID %d, Device ID %d", regr.UserID, regr.DeviceID)
-
-		cl, err := authy.NewClient()
-		if err != nil {
-			log.Fatalf("Couldn't create API client: %v", err)
-		}
+	output, ok := formats[*formatPtr]
+	if !ok {
+		log.Fatalf("Unknown output format %q", *formatPtr)
+	}
+	if output.binary && *outPtr == "" && *savePtr == "" {
+		log.Fatalf("The %s format must be written to a file with --out", *formatPtr)
+	}
+	if encryptExport && !output.encryptable {
+		log.Fatalf("The %s format can't be encrypted", *formatPtr)
+	}
 
-		// Fetch the apps
-		resp.Apps, err = cl.QueryAuthenticatorApps(nil, regr.UserID, regr.DeviceID, regr.Seed)
-		if err != nil {
-			log.Fatalf("Could not fetch authenticator apps: %v", err)
-		}
-		if !resp.Apps.Success {
-			log.Fatalf("Failed to fetch authenticator apps: %+v", resp.Apps)
-		}
+	issuers := loadIssuers(*issuersPtr)
 
-		// Fetch the actual tokens now
-		resp.Tokens, err = cl.QueryAuthenticatorTokens(nil, regr.UserID, regr.DeviceID, regr.Seed)
-		if err != nil {
-			log.Fatalf("Could not fetch authenticator tokens: %v", err)
-		}
-		if !resp.Tokens.Success {
-			log.Fatalf("Failed to fetch authenticator tokens: %+v", resp.Tokens)
+	var overrides []override
+	if *overridesPtr != "" {
+		if overrides, err = readOverrides(*overridesPtr); err != nil {
+			log.Fatalf("Failed to read the overrides file: %v", err)
 		}
 	}
 
-	if *savePtr != "" {
-		// Save encrypted tokens to json file
-		f, err := os.OpenFile(*savePtr, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
-		if err != nil {
-			log.Fatalf("Creating backup file failed: %v", err)
-		}
-		defer f.Close()
-		enc := json.NewEncoder(f)
-		enc.SetIndent("", "\t")
-		if err := enc.Encode(resp); err != nil {
-			log.Fatalf("Encoding backup file failed: %v", err)
+	var entries []entry
+	if *importPtr != "" {
+		// Get tokens from another app's backup
+		if *savePtr != "" || *loadPtr != "" || *appsJSONPtr != "" {
+			log.Fatal("--import can't be combined with --save, --load or --apps-json")
 		}
+		entries = importedEntries(readImport(*importPtr, *importFormatPtr))
 	} else {
-		// Display decrypted tokens to the terminal
-		// We'll need the prompt the user to give the decryption password
-		pp := []byte(os.Getenv("AUTHY_EXPORT_PASSWORD"))
-		if len(pp) == 0 {
-			log.Printf("Please provide your Authy TOTP backup password: ")
-			var err error
-			pp, err = terminal.ReadPassword(int(os.Stdin.Fd()))
-			if err != nil {
-				log.Fatalf("Failed to read the password: %v", err)
+		var resp backup
+		if *loadPtr != "" {
+			// Get tokens from the json file
+			if resp, err = readBackup(*loadPtr); err != nil {
+				log.Fatalf("Failed to read the file: %v", err)
 			}
-		}
+		} else {
+			// Get tokens from the server
+			regr, cl := deviceClient()
 
-		// Print out in https://github.com/google/google-authenticator/wiki/Key-Uri-Format format
-		log.Println("Here are your authenticator tokens:\n")
-		for _, tok := range resp.Tokens.AuthenticatorTokens {
-			decrypted, err := tok.Decrypt(string(pp))
-			if err != nil {
-				log.Printf("Failed to decrypt token %s: %v", tok.Description(), err)
-				continue
-			}
+			// Fetch the apps
+			resp.Apps = fetchApps(cl, regr)
 
-			params := url.Values{}
-			params.Set("secret", decrypted)
-			params.Set("digits", strconv.Itoa(tok.Digits))
-			u := url.URL{
-				Scheme:   "otpauth",
-				Host:     "totp",
-				Path:     tok.Description(),
-				RawQuery: params.Encode(),
-			}
-			fmt.Println(u.String())
+			// Fetch the actual tokens now
+			resp.Tokens = fetchTokens(cl, regr)
 		}
-		for _, app := range resp.Apps.AuthenticatorApps {
-			tok, err := app.Token()
-			if err != nil {
-				log.Printf("Failed to decode app %s: %v", app.Name, err)
-				continue
-			}
-			params := url.Values{}
-			params.Set("secret", tok)
-			params.Set("digits", strconv.Itoa(app.Digits))
-			params.Set("period", "10")
-			u := url.URL{
-				Scheme:   "otpauth",
-				Host:     "totp",
-				Path:     app.Name,
-				RawQuery: params.Encode(),
+
+		if *appsJSONPtr != "" {
+			if err := writeAppMetadata(*appsJSONPtr, resp.Apps, issuers, includeDeleted); err != nil {
+				log.Fatalf("Writing app metadata failed: %v", err)
 			}
-			fmt.Println(u.String())
 		}
-	}
-}
 
-func newInteractiveDeviceRegistration() (deviceRegistration, error) {
-	var regr deviceRegistration
-	// The first part of device registration requires the user's phone number that
-	// is attached to their Authy account
-	var phoneCC int
-	var phoneNumber string
-
-	var err error
-	sc := bufio.NewScanner(os.Stdin)
-	fmt.Print("\nWhat is your phone number's country code? (digits only): ")
-	if !sc.Scan() {
-		return regr, errors.New("Please provide a phone country code, e.g. 61")
-	}
-	if phoneCC, err = strconv.Atoi(strings.TrimSpace(sc.Text())); err != nil {
-		return regr, err
-	}
-	fmt.Print("\nWhat is your phone number? (digits only): ")
-	if !sc.Scan() {
-		return regr, errors.New("Please provide a phone country code, e.g. 12341234")
-	}
-	phoneNumber = strings.TrimSpace(sc.Text())
-	if err := sc.Err(); err != nil {
-		return regr, err
-	}
-
-	// Query the existence of the Authy account
-	cl, err := authy.NewClient()
-	if err != nil {
-		return regr, nil
-	}
-	userStatus, err := cl.QueryUser(nil, phoneCC, phoneNumber)
-	if err != nil {
-		return regr, err
-	}
-	if !userStatus.IsActiveUser() {
-		return regr, errors.New("There doesn't seem to be an Authy account attached to that phone number")
-	}
+		if *savePtr != "" {
+			// Save encrypted tokens to json file
+			if err := writeBackup(*savePtr, resp); err != nil {
+				log.Fatalf("Saving the backup file failed: %v", err)
+			}
+			return
+		}
 
-	// Begin a device registration using Authy app push notification
-	regStart, err := cl.RequestDeviceRegistration(nil, userStatus.AuthyID, authy.ViaMethodPush)
-	if err != nil {
-		return regr, err
-	}
-	if !regStart.Success {
-		return regr, fmt.Errorf("Authy did not accept the device registration request: %+v", regStart)
+		// We'll need the prompt the user to give the decryption password
+		pp := readBackupPassword()
+		entries = collectEntries(resp.Tokens, resp.Apps, pp, issuers, includeDeleted)
 	}
 
-	// Poll for a while until the user has responded to the device registration
-	var regPIN string
-	timeout := time.Now().Add(5 * time.Minute)
-	for {
-		if timeout.Before(time.Now()) {
-			return regr, errors.New("Gave up waiting for user to respond to Authy device registration request")
+	entries = applyOverrides(entries, overrides)
+	entries = filt.apply(entries)
+	if *selectPtr {
+		if entries, err = selectEntries(entries); err != nil {
+			log.Fatal(err)
 		}
+	}
 
-		log.Printf("Checking device registration status (%s until we give up)", time.Until(timeout).Truncate(time.Second))
-
-		regStatus, err := cl.CheckDeviceRegistration(nil, userStatus.AuthyID, regStart.RequestID)
+	w := os.Stdout
+	if *outPtr != "" {
+		f, err := os.OpenFile(*outPtr, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
 		if err != nil {
-			return regr, err
-		}
-		if regStatus.Status == "accepted" {
-			regPIN = regStatus.PIN
-			break
-		} else if regStatus.Status != "pending" {
-			return regr, fmt.Errorf("Invalid status while waiting for device registration: %s", regStatus.Status)
+			log.Fatalf("Creating the output file failed: %v", err)
 		}
-
-		time.Sleep(5 * time.Second)
-	}
-
-	// We have the registration PIN, complete the registration
-	regComplete, err := cl.CompleteDeviceRegistration(nil, userStatus.AuthyID, regPIN)
-	if err != nil {
-		return regr, err
+		defer f.Close()
+		w = f
 	}
-	if regComplete.Device.SecretSeed == "" {
-		return regr, errors.New("Something went wrong completing the device registration")
+	if err := output.write(w, entries); err != nil {
+		log.Fatalf("Writing the tokens failed: %v", err)
 	}
+}
 
-	regr.UserID = regComplete.AuthyID
-	regr.DeviceID = regComplete.Device.ID
-	regr.Seed = regComplete.Device.SecretSeed
-	regr.APIKey = regComplete.Device.APIKey
-
-	// We have everything we need, persist it to disk
-	regrPath, err := configPath()
-	if err != nil {
-		return regr, err
-	}
-	f, err := os.OpenFile(regrPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
-	if err != nil {
-		return regr, err
-	}
-	defer f.Close()
-	if err := json.NewEncoder(f).Encode(regr); err != nil {
-		return regr, err
-	}
+// appMetadata describes an Authy App without its secret, to identify the
+// service that it belongs to.
+type appMetadata struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Issuer      string `json:"issuer"`
+	AssetsGroup string `json:"assets_group"`
+	SerialID    int    `json:"serial_id"`
+	Version     int    `json:"version"`
+	AuthyID     uint64 `json:"authy_id"`
+	Digits      int    `json:"digits"`
+	Period      int    `json:"period"`
+	Deleted     bool   `json:"deleted"`
+}
 
-	return regr, nil
+// appsMetadata describes the apps, followed by the deleted ones if included.
+func appsMetadata(apps authy.AuthenticatorAppsResponse, issuers authy.IssuerTable, includeDeleted bool) []appMetadata {
+	out := []appMetadata{}
+	add := func(app authy.AuthenticatorApp, deleted bool) {
+		out = append(out, appMetadata{
+			ID:          app.ID,
+			Name:        app.Name,
+			Issuer:      issuers.App(app).Issuer,
+			AssetsGroup: app.AssetsGroup,
+			SerialID:    app.SerialID,
+			Version:     app.Version,
+			AuthyID:     app.AuthyID,
+			Digits:      app.Digits,
+			Period:      10,
+			Deleted:     deleted,
+		})
+	}
+	for _, app := range apps.AuthenticatorApps {
+		add(app, false)
+	}
+	if includeDeleted {
+		for _, app := range apps.Deleted {
+			add(app, true)
+		}
+	}
+	return out
 }
 
-func loadExistingDeviceRegistration() (deviceRegistration, error) {
-	regrPath, err := configPath()
+func writeAppMetadata(path string, apps authy.AuthenticatorAppsResponse, issuers authy.IssuerTable, includeDeleted bool) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
 	if err != nil {
-		return deviceRegistration{}, err
+		return err
 	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	return enc.Encode(appsMetadata(apps, issuers, includeDeleted))
+}
 
-	f, err := os.Open(regrPath)
+func readIssuerTable(path string) (authy.IssuerTable, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return deviceRegistration{}, err
+		return nil, err
 	}
 	defer f.Close()
-
-	var regr deviceRegistration
-	return regr, json.NewDecoder(f).Decode(&regr)
+	return authy.ReadIssuerTable(f)
 }
 
-func configPath() (string, error) {
-	// TODO: In Go 1.13, use os.UserConfigDir()
-	regrPath, err := os.UserHomeDir()
+// loadIssuers returns the built-in issuers, merged with those in the JSON
+// file at path, if it isn't empty.
+func loadIssuers(path string) authy.IssuerTable {
+	if path == "" {
+		return authy.DefaultIssuers
+	}
+	user, err := readIssuerTable(path)
 	if err != nil {
-		return "", err
+		log.Fatalf("Failed to read the issuers file: %v", err)
 	}
-	return filepath.Join(regrPath, "authy-go.json"), nil
+	return authy.DefaultIssuers.Merge(user)
 }
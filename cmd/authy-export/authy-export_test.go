@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy"
+)
+
+func TestAppsMetadata(t *testing.T) {
+	apps := authy.AuthenticatorAppsResponse{
+		AuthenticatorApps: []authy.AuthenticatorApp{
+			{ID: "app1", Name: "Twitch", AssetsGroup: "twitch", SerialID: 3, Version: 2, AuthyID: 123, Digits: 7, SecretSeed: testAppSeed},
+			{ID: "app2", Name: "My Site", AssetsGroup: "my_site", Digits: 7},
+			{ID: "app3", Name: "Sendgrid", Digits: 6},
+		},
+		Deleted: []authy.AuthenticatorApp{{ID: "app4", Name: "Old", AssetsGroup: "twitch", Digits: 7}},
+	}
+
+	got := appsMetadata(apps, authy.DefaultIssuers, false)
+	expected := []appMetadata{
+		{ID: "app1", Name: "Twitch", Issuer: "Twitch", AssetsGroup: "twitch", SerialID: 3, Version: 2, AuthyID: 123, Digits: 7, Period: 10},
+		{ID: "app2", Name: "My Site", Issuer: "My Site", AssetsGroup: "my_site", Digits: 7, Period: 10},
+		{ID: "app3", Name: "Sendgrid", Issuer: "Sendgrid", Digits: 6, Period: 10},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got %+v, expected %+v", got, expected)
+	}
+
+	got = appsMetadata(apps, authy.DefaultIssuers, true)
+	if len(got) != 4 || got[3].ID != "app4" || !got[3].Deleted || got[3].Issuer != "Twitch" {
+		t.Errorf("Expected the deleted app last, got %+v", got)
+	}
+}
+
+func TestWriteAppMetadata(t *testing.T) {
+	filename, cleanup := writeTemp(t, "apps.json", "")
+	defer cleanup()
+
+	// No apps is an empty list, not null
+	if err := writeAppMetadata(filename, authy.AuthenticatorAppsResponse{}, authy.DefaultIssuers, false); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(buf)) != "[]" {
+		t.Errorf("Wrote %s, expected an empty list", buf)
+	}
+
+	// The secrets are left out
+	apps := testBackup(t).Apps
+	if err := writeAppMetadata(filename, apps, authy.DefaultIssuers, true); err != nil {
+		t.Fatal(err)
+	}
+	if buf, err = ioutil.ReadFile(filename); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(buf), testAppSeed) {
+		t.Errorf("The metadata contains the app's secret: %s", buf)
+	}
+	var got []appMetadata
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, appsMetadata(apps, authy.DefaultIssuers, true)) {
+		t.Errorf("Wrote %s", buf)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/alexzorin/authy"
+	"github.com/alexzorin/authy/bitwarden"
+)
+
+// The collection to add the bitwarden export to, from --bitwarden-collection
+var bitwardenCollection string
+
+// writeBitwarden writes the entries as Bitwarden logins with TOTP, named by
+// their issuer. With --encrypt, the export is password-protected.
+func writeBitwarden(w io.Writer, entries []entry) error {
+	var export bitwarden.Export
+	for _, e := range entries {
+		if e.Err != nil {
+			log.Print(e.failure())
+			continue
+		}
+		name := e.Issuer
+		if name == "" {
+			name = e.Identity.Account
+		}
+		if e.Deleted {
+			name = deletedLabelPrefix + name
+		}
+		notes := fmt.Sprintf("Authy token %s", e.ID)
+		if e.Source == authy.SourceApp {
+			notes = fmt.Sprintf("Authy App %s", e.ID)
+		}
+		item, err := bitwarden.NewLogin(name, e.Identity.Account, e.uri(), notes)
+		if err != nil {
+			return err
+		}
+		export.Items = append(export.Items, item)
+	}
+	if bitwardenCollection != "" {
+		if err := export.AddToCollection(bitwardenCollection); err != nil {
+			return err
+		}
+	}
+
+	if !encryptExport {
+		return export.Write(w)
+	}
+	pp := readNewPassword("export password", false)
+	log.Printf("Encrypting %d tokens", len(export.Items))
+	return export.WriteEncrypted(w, string(pp), bitwarden.DefaultKDFIterations)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// codeCommand prints the current code of a single account, for scripts.
+func codeCommand(args []string) {
+	fs := flag.NewFlagSet("code", flag.ExitOnError)
+	minLeftPtr := fs.Int("min-remaining", 0, "If the code changes in fewer than this many seconds, wait for the next one")
+	exactPtr := fs.Bool("exact", false, "Only match the name, label or ID exactly, rather than fuzzily")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: authy-export code [flags] <name or ID>\n")
+		fs.PrintDefaults()
+	}
+	loadAccounts := accountFlags(fs)
+	applyClientFlags := clientFlags(fs)
+	fs.Parse(args)
+	applyClientFlags()
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	e, err := findEntry(loadAccounts(), fs.Arg(0), !*exactPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	code, err := nextCode(e, *minLeftPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(code)
+}
+
+// findEntry finds the entry with the ID, name or label ref, which are
+// matched case-insensitively. If none match exactly and fuzzy is set, the
+// entry whose name or label fuzzily matches ref is found instead. Either way,
+// the match must be unambiguous.
+func findEntry(entries []entry, ref string, fuzzy bool) (entry, error) {
+	var matches []entry
+	for _, e := range entries {
+		if e.ID == ref {
+			if e.Err != nil {
+				return entry{}, errors.New(e.failure())
+			}
+			return e, nil
+		}
+		if strings.EqualFold(e.Name, ref) || strings.EqualFold(e.Label(), ref) {
+			matches = append(matches, e)
+		}
+	}
+	if len(matches) == 0 && fuzzy {
+		for _, e := range entries {
+			if fuzzyMatch(ref, e.Name) || fuzzyMatch(ref, e.Label()) {
+				matches = append(matches, e)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return entry{}, noTokenError(ref)
+	case 1:
+		if matches[0].Err != nil {
+			return entry{}, errors.New(matches[0].failure())
+		}
+		return matches[0], nil
+	}
+	var names []string
+	for _, e := range matches {
+		names = append(names, fmt.Sprintf("%s (%s)", e.Label(), e.ID))
+	}
+	return entry{}, fmt.Errorf("%q matches several tokens, please use one of their IDs: %s",
+		ref, strings.Join(names, ", "))
+}
+
+// nextCode returns the current code of e, or waits for the next one if the
+// current one changes in fewer than minLeft seconds.
+func nextCode(e entry, minLeft int) (string, error) {
+	now := time.Now()
+	at, err := codeTime(e, minLeft, now)
+	if err != nil {
+		return "", err
+	}
+	if left := at.Sub(now); left > 0 {
+		log.Printf("Waiting %.1fs for the next code", left.Seconds())
+		time.Sleep(left)
+	}
+	return e.Code(at)
+}
+
+// codeTime returns when the first code of e with at least minLeft seconds
+// left is valid: now, or the start of the next period.
+func codeTime(e entry, minLeft int, now time.Time) (time.Time, error) {
+	if minLeft > e.Period {
+		return time.Time{}, fmt.Errorf("%s has a period of %d seconds, less than the %d seconds asked for",
+			e.Label(), e.Period, minLeft)
+	}
+	next := time.Unix((now.Unix()/int64(e.Period)+1)*int64(e.Period), 0)
+	if next.Sub(now) < time.Duration(minLeft)*time.Second {
+		return next, nil
+	}
+	return now, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFindEntry(t *testing.T) {
+	failed := totpEntry("3", "Google", "carol", 30)
+	failed.Secret, failed.Err = "", errors.New("wrong password")
+	entries := []entry{
+		totpEntry("1", "GitHub", "alice", 30),
+		totpEntry("2", "GitHub", "bob", 30),
+		failed,
+		totpEntry("4", "Twitch", "Twitch", 10),
+		totpEntry("5", "Git", "dave", 30),
+	}
+
+	tests := []struct {
+		ref      string
+		fuzzy    bool
+		expected string
+		err      string
+	}{
+		{ref: "1", expected: "1"},
+		{ref: "4", fuzzy: true, expected: "4"},
+		// By name or label, ignoring case
+		{ref: "github: ALICE", expected: "1"},
+		{ref: "GitHub:bob", expected: "2"},
+		// Fuzzily, only if nothing matches exactly
+		{ref: "ghal", fuzzy: true, expected: "1"},
+		{ref: "ghal", err: `No token matches "ghal"`},
+		{ref: "git:dave", fuzzy: true, expected: "5"},
+		{ref: "twch", fuzzy: true, expected: "4"},
+		// Ambiguous matches are refused
+		{ref: "github", fuzzy: true, err: `"github" matches several tokens, please use one of their IDs: GitHub:alice (1), GitHub:bob (2)`},
+		{ref: "zzz", fuzzy: true, err: `No token matches "zzz"`},
+		// Entries without secrets are refused, however they're found
+		{ref: "3", err: "Failed to decrypt token Google: carol: wrong password"},
+		{ref: "Google:carol", err: "Failed to decrypt token Google: carol"},
+		{ref: "goocar", fuzzy: true, err: "Failed to decrypt token Google: carol"},
+	}
+	for _, tc := range tests {
+		e, err := findEntry(entries, tc.ref, tc.fuzzy)
+		if tc.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("findEntry(%q, %v): expected the error %q, got %v", tc.ref, tc.fuzzy, tc.err, err)
+			}
+			continue
+		}
+		if err != nil || e.ID != tc.expected {
+			t.Errorf("findEntry(%q, %v) = %s, %v, expected %s", tc.ref, tc.fuzzy, e.ID, err, tc.expected)
+		}
+	}
+}
+
+func TestCodeTime(t *testing.T) {
+	tests := []struct {
+		period   int
+		minLeft  int
+		now      time.Time
+		expected time.Time
+	}{
+		// 1s left
+		{30, 0, time.Unix(59, 0), time.Unix(59, 0)},
+		{30, 1, time.Unix(59, 0), time.Unix(59, 0)},
+		{30, 2, time.Unix(59, 0), time.Unix(60, 0)},
+		// 0.5s left
+		{30, 1, time.Unix(59, 5e8), time.Unix(60, 0)},
+		// The whole period left
+		{30, 30, time.Unix(60, 0), time.Unix(60, 0)},
+		// Authy Apps change every 10s
+		{10, 5, time.Unix(55, 0), time.Unix(55, 0)},
+		{10, 6, time.Unix(55, 0), time.Unix(60, 0)},
+		{10, 10, time.Unix(55, 0), time.Unix(60, 0)},
+	}
+	for _, tc := range tests {
+		got, err := codeTime(totpEntry("1", "GitHub", "alice", tc.period), tc.minLeft, tc.now)
+		if err != nil || !got.Equal(tc.expected) {
+			t.Errorf("Period %d, %ds left at %v: got %v, %v, expected %v", tc.period, tc.minLeft, tc.now, got, err, tc.expected)
+		}
+	}
+
+	if _, err := codeTime(totpEntry("4", "Twitch", "Twitch", 10), 11, time.Unix(50, 0)); err == nil ||
+		!strings.Contains(err.Error(), "period of 10 seconds, less than the 11 seconds") {
+		t.Errorf("Expected an error for a minimum longer than the period, got %v", err)
+	}
+
+	// The code is that of the period the time is in (RFC 6238's vectors,
+	// truncated to 6 digits)
+	e := totpEntry("1", "GitHub", "alice", 30)
+	for _, at := range []struct {
+		minLeft int
+		now     int64
+		code    string
+	}{
+		{0, 1111111109, "081804"},
+		{5, 1111111109, "050471"},
+	} {
+		t0, err := codeTime(e, at.minLeft, time.Unix(at.now, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code, err := e.Code(t0); err != nil || code != at.code {
+			t.Errorf("%ds left at %d: got the code %s, %v, expected %s", at.minLeft, at.now, code, err, at.code)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		expected   bool
+	}{
+		{"", "anything", true},
+		{"gh", "GitHub", true},
+		{"GH", "github", true},
+		{"hg", "GitHub", false},
+		{"éa", "Élan Vital", true},
+		{"aa", "a", false},
+	}
+	for _, tc := range tests {
+		if got := fuzzyMatch(tc.pattern, tc.s); got != tc.expected {
+			t.Errorf("fuzzyMatch(%q, %q) = %v", tc.pattern, tc.s, got)
+		}
+	}
+}
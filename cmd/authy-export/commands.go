@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/alexzorin/authy"
+	"github.com/alexzorin/authy/cassette"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Commands are run as `authy-export <command> [flags]`. Without a command,
+// authy-export exports the tokens.
+var commands = map[string]func(args []string){
+	"add-token":       addTokenCommand,
+	"code":            codeCommand,
+	"approvals":       approvalsCommand,
+	"delete":          deleteCommand,
+	"exec":            execCommand,
+	"export-key":      exportKeyCommand,
+	"import":          importCommand,
+	"rename":          renameCommand,
+	"restore":         restoreCommand,
+	"rotate-password": rotatePasswordCommand,
+	"set-type":        setTypeCommand,
+	"watch":           watchCommand,
+}
+
+// Options for every API client, set from the command line. The Authy API is
+// quick to suspend accounts that misbehave, so requests are sent no faster
+// than the official apps might.
+var clientOpts = []authy.ClientOption{authy.WithRateLimit(2, 4)}
+
+// clientFlags defines the flags which configure API clients on fs. The
+// returned function applies them to clientOpts once fs has been parsed.
+func clientFlags(fs *flag.FlagSet) func() {
+	recordPtr := fs.String("record", "", "Record the session with the Authy API to this file, with secrets redacted")
+	replayPtr := fs.String("replay", "", "Replay a session recorded with --record instead of contacting the server")
+
+	return func() {
+		if *recordPtr != "" && *replayPtr != "" {
+			log.Fatal("Only one of --record and --replay may be used")
+		}
+		if *recordPtr != "" {
+			clientOpts = append(clientOpts, authy.WithTransport(cassette.NewRecorder(*recordPtr, nil)))
+		}
+		if *replayPtr != "" {
+			c, err := cassette.Load(*replayPtr)
+			if err != nil {
+				log.Fatalf("Failed to load the recorded session: %v", err)
+			}
+			clientOpts = append(clientOpts, authy.WithTransport(cassette.NewReplayer(c)))
+		}
+	}
+}
+
+// deviceClient returns the device registration, registering a new device
+// if there isn't one yet, and an API client to use with it.
+func deviceClient() (deviceRegistration, *authy.Client) {
+	// If we don't already have a registered device, prompt the user for one
+	regr, err := loadExistingDeviceRegistration()
+	if err == nil {
+		log.Println("Found existing device registration")
+	} else if os.IsNotExist(err) {
+		log.Println("No existing device registration found, will perform registration now")
+		regr, err = newInteractiveDeviceRegistration()
+		if err != nil {
+			log.Fatalf("Device registration failed: %v", err)
+		}
+	} else if err != nil {
+		log.Fatalf("Could not check for existing device registration: %v", err)
+	}
+
+	// By now we have a valid user and device ID
+	log.Printf("Authy User ID %d, Device ID %d", regr.UserID, regr.DeviceID)
+
+	cl, err := authy.NewClient(clientOpts...)
+	if err != nil {
+		log.Fatalf("Couldn't create API client: %v", err)
+	}
+
+	// Registrations made by older versions don't have the device key yet
+	if regr.PrivateKey == "" {
+		if err := fetchDevicePrivateKey(cl, &regr); err != nil {
+			log.Printf("Could not fetch the device private key: %v", err)
+		} else if err := saveDeviceRegistration(regr); err != nil {
+			log.Printf("Could not save the device private key: %v", err)
+		}
+	}
+
+	return regr, cl
+}
+
+// readBackupPassword returns the Authy backup password from the
+// AUTHY_EXPORT_PASSWORD environment variable, or else prompts for it.
+func readBackupPassword() []byte {
+	pp := []byte(os.Getenv("AUTHY_EXPORT_PASSWORD"))
+	if len(pp) == 0 {
+		log.Printf("Please provide your Authy TOTP backup password: ")
+		var err error
+		pp, err = terminal.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			log.Fatalf("Failed to read the password: %v", err)
+		}
+	}
+	return pp
+}
+
+// readNewPassword prompts twice for a new password, which is described by
+// what, e.g. "backup password". It may only be empty if allowEmpty is set.
+func readNewPassword(what string, allowEmpty bool) []byte {
+	log.Printf("Please choose the %s: ", what)
+	pp, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		log.Fatalf("Failed to read the %s: %v", what, err)
+	}
+	log.Printf("Please repeat the %s: ", what)
+	confirm, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	if err != nil {
+		log.Fatalf("Failed to read the %s: %v", what, err)
+	}
+	if !bytes.Equal(pp, confirm) {
+		log.Fatalf("The %ss did not match", what)
+	}
+	if len(pp) == 0 && !allowEmpty {
+		log.Fatalf("The %s must not be empty", what)
+	}
+	return pp
+}
+
+// fetchTokens fetches the encrypted TOTP tokens of the registered device's user.
+func fetchTokens(cl *authy.Client, regr deviceRegistration) authy.AuthenticatorTokensResponse {
+	resp, err := cl.QueryAuthenticatorTokens(nil, regr.UserID, regr.DeviceID, regr.Seed)
+	if err != nil {
+		log.Fatalf("Could not fetch authenticator tokens: %v", err)
+	}
+	if !resp.Success {
+		log.Fatalf("Failed to fetch authenticator tokens: %+v", resp)
+	}
+	return resp
+}
+
+// fetchApps fetches the Authy Apps of the registered device's user.
+func fetchApps(cl *authy.Client, regr deviceRegistration) authy.AuthenticatorAppsResponse {
+	resp, err := cl.QueryAuthenticatorApps(nil, regr.UserID, regr.DeviceID, regr.Seed)
+	if err != nil {
+		log.Fatalf("Could not fetch authenticator apps: %v", err)
+	}
+	if !resp.Success {
+		log.Fatalf("Failed to fetch authenticator apps: %+v", resp)
+	}
+	return resp
+}
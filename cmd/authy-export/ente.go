@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/url"
+
+	"github.com/alexzorin/authy/ente"
+)
+
+// writeEnte writes the entries as an encrypted Ente Auth export. Ente keeps
+// tags and trashed (deleted) codes in the codeDisplay parameter of their
+// Key URIs.
+func writeEnte(w io.Writer, entries []entry) error {
+	var uris []string
+	for _, e := range entries {
+		if e.Err != nil {
+			log.Print(e.failure())
+			continue
+		}
+		uri := e.uri()
+		if len(e.Tags) > 0 || e.Deleted {
+			display, err := json.Marshal(struct {
+				Tags    []string `json:"tags,omitempty"`
+				Trashed bool     `json:"trashed,omitempty"`
+			}{e.Tags, e.Deleted})
+			if err != nil {
+				return err
+			}
+			uri += "&codeDisplay=" + url.QueryEscape(string(display))
+		}
+		uris = append(uris, uri)
+	}
+
+	pp := readNewPassword("Ente Auth export password", false)
+	log.Printf("Encrypting %d tokens", len(uris))
+	export, err := ente.Encrypt(uris, string(pp))
+	if err != nil {
+		return err
+	}
+	return export.Write(w)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/alexzorin/authy"
+)
+
+// entry is a decrypted token, Authy App or imported key, ready to be
+// exported.
+type entry struct {
+	authy.Account
+
+	// Why the entry couldn't be decrypted, or its secret is invalid, in which
+	// case it has no Secret
+	Err error
+}
+
+// invalid reports whether the entry was decrypted, but its secret is invalid.
+func (e entry) invalid() bool {
+	_, ok := e.Err.(*authy.InvalidSecretError)
+	return ok
+}
+
+// failure describes why the entry has no Secret.
+func (e entry) failure() string {
+	if e.invalid() {
+		return fmt.Sprintf("Invalid secret in %s %s: %v", e.Source, e.Name, e.Err)
+	}
+	return fmt.Sprintf("Failed to decrypt %s %s: %v", e.Source, e.Name, e.Err)
+}
+
+// Deleted entries are labelled with this prefix, so they stand out after
+// being imported elsewhere
+const deletedLabelPrefix = "[Deleted] "
+
+// collectEntries decrypts the tokens with the backup password pp, and
+// decodes the apps. Deleted ones follow the rest, if included.
+func collectEntries(tokens authy.AuthenticatorTokensResponse, apps authy.AuthenticatorAppsResponse, pp []byte,
+	issuers authy.IssuerTable, includeDeleted bool) []entry {
+	var out []entry
+	addTokens := func(toks []authy.AuthenticatorToken, deleted bool) {
+		for _, tok := range toks {
+			var e entry
+			e.Account, e.Err = authy.NewTokenAccount(tok, string(pp), issuers)
+			e.Deleted = deleted
+			out = append(out, e)
+		}
+	}
+	addApps := func(as []authy.AuthenticatorApp, deleted bool) {
+		for _, app := range as {
+			var e entry
+			e.Account, e.Err = authy.NewAppAccount(app, issuers)
+			e.Deleted = deleted
+			out = append(out, e)
+		}
+	}
+
+	addTokens(tokens.AuthenticatorTokens, false)
+	addApps(apps.AuthenticatorApps, false)
+	if includeDeleted {
+		addTokens(tokens.Deleted, true)
+		addApps(apps.Deleted, true)
+	}
+	return out
+}
+
+// uri returns the entry in https://github.com/google/google-authenticator/wiki/Key-Uri-Format format.
+func (e entry) uri() string {
+	k := e.Key()
+	if e.Deleted {
+		k.Account = deletedLabelPrefix + k.Account
+	}
+	return k.URI()
+}
+
+func printURIs(w io.Writer, entries []entry) error {
+	log.Print("Here are your authenticator tokens:\n\n")
+	var deleted bool
+	for _, e := range entries {
+		if e.Err != nil {
+			log.Print(e.failure())
+			continue
+		}
+		if e.Deleted && !deleted {
+			deleted = true
+			log.Print("Here are your deleted authenticator tokens, which can be restored " +
+				"with `authy-export restore <token>`:\n\n")
+		}
+		if weakness := e.Weakness(); weakness != "" {
+			log.Printf("Warning: the secret of %s looks weak, as %s", e.Name, weakness)
+		}
+		fmt.Fprintln(w, e.uri())
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy"
+)
+
+const (
+	testPassword = "backup password"
+	testSeed     = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	testAppSeed  = "48656c6c6f21deadbeef48656c6c6f21deadbeef"
+)
+
+// testToken returns a token with the seed testSeed, encrypted with
+// testPassword.
+func testToken(t *testing.T, id, name string) authy.AuthenticatorToken {
+	tok := authy.AuthenticatorToken{UniqueID: id, Name: name, AccountType: "github", Digits: 6}
+	if err := tok.Encrypt(testSeed, testPassword); err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+// testBackup returns a backup with a token, an app, and one deleted of each.
+func testBackup(t *testing.T) backup {
+	return backup{
+		Tokens: authy.AuthenticatorTokensResponse{
+			AuthenticatorTokens: []authy.AuthenticatorToken{testToken(t, "1", "GitHub: alice")},
+			Deleted:             []authy.AuthenticatorToken{testToken(t, "2", "GitHub: bob")},
+		},
+		Apps: authy.AuthenticatorAppsResponse{
+			AuthenticatorApps: []authy.AuthenticatorApp{{ID: "app1", Name: "Twitch", AssetsGroup: "twitch", Digits: 7, SecretSeed: testAppSeed}},
+			Deleted:           []authy.AuthenticatorApp{{ID: "app2", Name: "SendGrid", Digits: 7, SecretSeed: testAppSeed}},
+		},
+	}
+}
+
+// ids returns the IDs of the entries, with deleted ones marked by a *.
+func ids(entries []entry) string {
+	var out []string
+	for _, e := range entries {
+		id := e.ID
+		if e.Deleted {
+			id += "*"
+		}
+		out = append(out, id)
+	}
+	return strings.Join(out, " ")
+}
+
+func TestCollectEntries(t *testing.T) {
+	b := testBackup(t)
+
+	entries := collectEntries(b.Tokens, b.Apps, []byte(testPassword), authy.DefaultIssuers, false)
+	if got := ids(entries); got != "1 app1" {
+		t.Errorf("Collected %s, expected the tokens and apps which aren't deleted", got)
+	}
+
+	// Deleted ones follow the rest
+	entries = collectEntries(b.Tokens, b.Apps, []byte(testPassword), authy.DefaultIssuers, true)
+	if got := ids(entries); got != "1 app1 2* app2*" {
+		t.Fatalf("Collected %s, expected the deleted tokens and apps last", got)
+	}
+	for _, e := range entries {
+		if e.Err != nil || e.Secret == "" {
+			t.Errorf("%s wasn't decrypted: %v", e.ID, e.Err)
+		}
+	}
+	if e := entries[2]; e.Source != authy.SourceToken || e.Secret != testSeed || e.Issuer != "GitHub" || e.Identity.Account != "bob" {
+		t.Errorf("Unexpected deleted token %+v", e)
+	}
+	if e := entries[3]; e.Source != authy.SourceApp || e.Digits != 7 || e.Period != 10 {
+		t.Errorf("Unexpected deleted app %+v", e)
+	}
+}
+
+func TestCollectEntriesWrongPassword(t *testing.T) {
+	b := testBackup(t)
+	entries := collectEntries(b.Tokens, b.Apps, []byte("wrong password"), authy.DefaultIssuers, true)
+	for _, e := range entries {
+		if e.Source == authy.SourceApp {
+			// Apps aren't encrypted with the backup password
+			if e.Err != nil {
+				t.Errorf("App %s failed: %v", e.ID, e.Err)
+			}
+			continue
+		}
+		if e.Err == nil || e.Secret != "" || e.invalid() {
+			t.Errorf("Token %s was decrypted with the wrong password: %+v", e.ID, e)
+		}
+		if msg := e.failure(); !strings.HasPrefix(msg, "Failed to decrypt token GitHub:") {
+			t.Errorf("Unexpected failure %q", msg)
+		}
+	}
+}
+
+func TestDeletedEntryURI(t *testing.T) {
+	b := testBackup(t)
+	entries := collectEntries(b.Tokens, b.Apps, []byte(testPassword), authy.DefaultIssuers, true)
+	if uri := entries[0].uri(); strings.Contains(uri, "Deleted") {
+		t.Errorf("The token isn't deleted, but its URI is %s", uri)
+	}
+	if uri := entries[2].uri(); !strings.Contains(uri, "GitHub:%5BDeleted%5D%20bob") {
+		t.Errorf("The deleted token's URI %s isn't labelled as deleted", uri)
+	}
+	if entries[2].Identity.Account != "bob" {
+		t.Error("Labelling the URI modified the entry")
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+)
+
+// execCommand runs a command with the current code of an account in its
+// environment or on its stdin, so that the code never appears on a command
+// line or in the shell's history.
+func execCommand(args []string) {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	accountPtr := fs.String("account", "", "Name or ID of the token whose code to pass to the command")
+	exactPtr := fs.Bool("exact", false, "Only match the name, label or ID exactly, rather than fuzzily")
+	envPtr := fs.String("env", "", "Pass the code in this environment variable")
+	stdinPtr := fs.Bool("stdin", false, "Pass the code as a line on the command's stdin")
+	minLeftPtr := fs.Int("min-remaining", 5, "If the code changes in fewer than this many seconds, wait for the next one")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: authy-export exec --account <name or ID> [--env NAME] [--stdin] [flags] -- <command> [args]\n")
+		fs.PrintDefaults()
+	}
+	loadAccounts := accountFlags(fs)
+	applyClientFlags := clientFlags(fs)
+	fs.Parse(args)
+	applyClientFlags()
+	if fs.NArg() == 0 || *accountPtr == "" || (*envPtr == "" && !*stdinPtr) {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if strings.Contains(*envPtr, "=") {
+		log.Fatalf("Invalid environment variable name %q", *envPtr)
+	}
+
+	e, err := findEntry(loadAccounts(), *accountPtr, !*exactPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	code, err := nextCode(e, *minLeftPtr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmd := commandWithCode(fs.Args(), code, *envPtr, *stdinPtr)
+
+	// The command gets the terminal's interrupts too, so leave it to
+	// decide whether to exit, and wait for it. Ignoring them instead would
+	// make the command ignore them as well.
+	signal.Notify(make(chan os.Signal, 1), os.Interrupt)
+
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() >= 0 {
+			os.Exit(exitErr.ExitCode())
+		}
+		log.Fatalf("Failed to run %s: %v", fs.Arg(0), err)
+	}
+}
+
+// commandWithCode returns the command argv, which is passed code in the
+// environment variable env, if set, and on its stdin if stdin is set.
+// Otherwise it inherits the environment and stdio.
+func commandWithCode(argv []string, code, env string, stdin bool) *exec.Cmd {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = os.Environ()
+	if env != "" {
+		cmd.Env = append(cmd.Env, env+"="+code)
+	}
+	if stdin {
+		cmd.Stdin = strings.NewReader(code + "\n")
+	}
+	return cmd
+}
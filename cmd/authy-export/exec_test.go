@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestCommandWithCode(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("No shell to run")
+	}
+	script := `printf "env=%s " "$OTP_CODE"; read line; printf "stdin=%s" "$line"`
+	tests := []struct {
+		env      string
+		stdin    bool
+		expected string
+	}{
+		{"OTP_CODE", false, "env=123456 stdin="},
+		{"", true, "env= stdin=123456"},
+		{"OTP_CODE", true, "env=123456 stdin=123456"},
+	}
+	for _, tc := range tests {
+		cmd := commandWithCode([]string{"sh", "-c", script}, "123456", tc.env, tc.stdin)
+		if !tc.stdin {
+			if cmd.Stdin != os.Stdin {
+				t.Errorf("%+v: the command doesn't inherit stdin", tc)
+			}
+			cmd.Stdin = bytes.NewReader(nil)
+		}
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		if err := cmd.Run(); err != nil {
+			t.Fatalf("%+v: %v", tc, err)
+		}
+		if out.String() != tc.expected {
+			t.Errorf("%+v: got %q, expected %q", tc, out.String(), tc.expected)
+		}
+	}
+
+	// The rest of the environment is kept, and the code isn't an argument
+	cmd := commandWithCode([]string{"env", "-0"}, "123456", "OTP_CODE", false)
+	if len(cmd.Env) != len(os.Environ())+1 || cmd.Env[len(cmd.Env)-1] != "OTP_CODE=123456" {
+		t.Errorf("Unexpected environment %q", cmd.Env)
+	}
+	if len(cmd.Args) != 2 || cmd.Args[1] != "-0" {
+		t.Errorf("Unexpected args %q", cmd.Args)
+	}
+}
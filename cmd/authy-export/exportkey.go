@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/alexzorin/authy"
+)
+
+// exportKeyCommand writes the device RSA private key as a passphrase-encrypted
+// PKCS#8 PEM file, e.g. for forensic or recovery use.
+func exportKeyCommand(args []string) {
+	fs := flag.NewFlagSet("export-key", flag.ExitOnError)
+	outPtr := fs.String("out", "", "Write the encrypted key to this file instead of stdout")
+	applyClientFlags := clientFlags(fs)
+	fs.Parse(args)
+	applyClientFlags()
+
+	regr, _ := deviceClient()
+	if regr.PrivateKey == "" {
+		log.Fatal("The device private key is not available")
+	}
+	pk, err := authy.ParsePrivateKey(regr.PrivateKey)
+	if err != nil {
+		log.Fatalf("Failed to parse the device private key: %v", err)
+	}
+
+	pp := readNewPassword("key passphrase", false)
+
+	out, err := authy.MarshalEncryptedPKCS8(pk, pp)
+	if err != nil {
+		log.Fatalf("Failed to encrypt the device private key: %v", err)
+	}
+	if *outPtr == "" {
+		os.Stdout.Write(out)
+		return
+	}
+	if err := ioutil.WriteFile(*outPtr, out, 0600); err != nil {
+		log.Fatalf("Failed to write the device private key: %v", err)
+	}
+	log.Printf("Wrote the encrypted device private key to %s", *outPtr)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/alexzorin/authy"
+)
+
+// filter selects which entries are exported.
+type filter struct {
+	match       *regexp.Regexp
+	types       map[string]bool
+	kind        string
+	digits      int
+	onlyDeleted bool
+}
+
+// filterFlags defines the filtering flags on fs. The returned function
+// builds the filter once fs has been parsed.
+func filterFlags(fs *flag.FlagSet) func() (filter, error) {
+	matchPtr := fs.String("match", "", "Only export tokens whose name or label matches this regular expression (case-insensitive)")
+	typePtr := fs.String("type", "", "Only export tokens with these account types (comma-separated, e.g. google,github)")
+	kindPtr := fs.String("kind", "", "Only export this kind of token: token, app, or import for imported keys")
+	digitsPtr := fs.Int("digits", 0, "Only export tokens with this many digits")
+	onlyDeletedPtr := fs.Bool("only-deleted", false, "Only export recently deleted tokens")
+
+	return func() (filter, error) {
+		f := filter{
+			kind:        *kindPtr,
+			digits:      *digitsPtr,
+			onlyDeleted: *onlyDeletedPtr,
+		}
+		if *matchPtr != "" {
+			re, err := regexp.Compile("(?i)" + *matchPtr)
+			if err != nil {
+				return f, fmt.Errorf("Invalid --match expression: %v", err)
+			}
+			f.match = re
+		}
+		if *typePtr != "" {
+			f.types = map[string]bool{}
+			for _, t := range strings.Split(*typePtr, ",") {
+				f.types[strings.ToLower(strings.TrimSpace(t))] = true
+			}
+		}
+		switch f.kind {
+		case "", authy.SourceToken, authy.SourceApp, authy.SourceImport:
+		default:
+			return f, fmt.Errorf("Invalid --kind %q, must be token, app or import", f.kind)
+		}
+		return f, nil
+	}
+}
+
+func (f filter) keep(e entry) bool {
+	if f.match != nil && !f.match.MatchString(e.Name) && !f.match.MatchString(e.Label()) {
+		return false
+	}
+	if f.types != nil && !f.types[strings.ToLower(e.AccountType)] {
+		return false
+	}
+	if f.kind != "" && f.kind != e.Source {
+		return false
+	}
+	if f.digits != 0 && f.digits != e.Digits {
+		return false
+	}
+	if f.onlyDeleted && !e.Deleted {
+		return false
+	}
+	return true
+}
+
+func (f filter) apply(entries []entry) []entry {
+	var out []entry
+	for _, e := range entries {
+		if f.keep(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
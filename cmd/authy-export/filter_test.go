@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy"
+)
+
+// parseFilter builds a filter from the command line args.
+func parseFilter(args ...string) (filter, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	build := filterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return filter{}, err
+	}
+	return build()
+}
+
+func TestFilter(t *testing.T) {
+	newEntry := func(id, source, name, issuer, accountType string, digits int, deleted bool) entry {
+		return entry{Account: authy.Account{
+			Source: source, ID: id, Name: name, AccountType: accountType,
+			Identity: authy.Identity{Issuer: issuer, Account: name},
+			Digits:   digits, Deleted: deleted,
+		}}
+	}
+	entries := []entry{
+		newEntry("1", authy.SourceToken, "alice", "GitHub", "github", 6, false),
+		newEntry("2", authy.SourceToken, "Work Google", "Google", "google", 6, false),
+		newEntry("3", authy.SourceToken, "bob", "Amazon Web Services", "aws", 8, true),
+		newEntry("4", authy.SourceApp, "Twitch", "Twitch", "twitch", 7, false),
+		newEntry("5", authy.SourceImport, "carol", "GitLab", "", 6, false),
+	}
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "1 2 3* 4 5"},
+		// The name or the label, case-insensitively
+		{[]string{"--match", "^work"}, "2"},
+		{[]string{"--match", "github:ALICE"}, "1"},
+		{[]string{"--match", "git(hub|lab)"}, "1 5"},
+		{[]string{"--type", "GitHub, aws"}, "1 3*"},
+		{[]string{"--kind", "app"}, "4"},
+		{[]string{"--kind", "import"}, "5"},
+		{[]string{"--digits", "6"}, "1 2 5"},
+		{[]string{"--only-deleted"}, "3*"},
+		// Every filter must match
+		{[]string{"--kind", "token", "--digits", "6", "--match", "o"}, "2"},
+		{[]string{"--type", "twitch", "--kind", "token"}, ""},
+	}
+	for _, tc := range tests {
+		f, err := parseFilter(tc.args...)
+		if err != nil {
+			t.Errorf("%v: %v", tc.args, err)
+			continue
+		}
+		if got := ids(f.apply(entries)); got != tc.expected {
+			t.Errorf("%v kept %q, expected %q", tc.args, got, tc.expected)
+		}
+	}
+}
+
+func TestFilterFlagsInvalid(t *testing.T) {
+	tests := map[string][]string{
+		"Invalid --match expression": {"--match", "(unclosed"},
+		`Invalid --kind "tokens"`:    {"--kind", "tokens"},
+	}
+	for expected, args := range tests {
+		if _, err := parseFilter(args...); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%v: expected an error containing %q, got %v", args, expected, err)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alexzorin/authy"
+	"github.com/alexzorin/authy/aegis"
+	"github.com/alexzorin/authy/andotp"
+	"github.com/alexzorin/authy/bitwarden"
+	"github.com/alexzorin/authy/googleauth"
+	"github.com/alexzorin/authy/otpauth"
+	"github.com/alexzorin/authy/twofas"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Readers of other authenticator apps' backups, by the name given to
+// --import-format. The password is empty unless the reader asked for one.
+var importers = map[string]func(r io.Reader, password string) ([]otpauth.Key, error){
+	"otpauth": func(r io.Reader, _ string) ([]otpauth.Key, error) {
+		return otpauth.ReadURIs(r)
+	},
+	"aegis":     aegis.Read,
+	"andotp":    andotp.Read,
+	"2fas":      twofas.Read,
+	"bitwarden": bitwarden.Read,
+	"google": func(r io.Reader, _ string) ([]otpauth.Key, error) {
+		return googleauth.Read(r)
+	},
+}
+
+func importFormatNames() string {
+	var names []string
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// readImport reads the keys from a backup of another app. If the backup is
+// encrypted, its password is taken from the AUTHY_IMPORT_PASSWORD
+// environment variable, or else prompted for. Entries of unsupported types
+// are reported, and left out.
+func readImport(path, format string) []otpauth.Key {
+	read, ok := importers[format]
+	if !ok {
+		log.Fatalf("Unknown import format %q, must be one of: %s", format, importFormatNames())
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read the file to import: %v", err)
+	}
+
+	keys, err := read(bytes.NewReader(data), "")
+	if err == otpauth.ErrPasswordRequired {
+		pp := []byte(os.Getenv("AUTHY_IMPORT_PASSWORD"))
+		if len(pp) == 0 {
+			log.Printf("Please provide the password of the backup to import: ")
+			if pp, err = terminal.ReadPassword(int(os.Stdin.Fd())); err != nil {
+				log.Fatalf("Failed to read the password: %v", err)
+			}
+		}
+		keys, err = read(bytes.NewReader(data), string(pp))
+	}
+	// Entries that can't be read are reported, and the rest imported
+	if uerr, ok := err.(*otpauth.UnsupportedError); ok {
+		for _, s := range uerr.Skipped {
+			log.Printf("Leaving out %s, which isn't supported", s)
+		}
+		err = nil
+	}
+	if err != nil {
+		log.Fatalf("Failed to import %s: %v", path, err)
+	}
+	return keys
+}
+
+// importedEntries returns the TOTP keys as entries to be exported. Other
+// kinds of keys are left out, and reported.
+func importedEntries(keys []otpauth.Key) []entry {
+	var out []entry
+	for _, k := range keys {
+		a, err := authy.NewImportedAccount(k)
+		if err != nil {
+			log.Printf("Leaving out %s: %v", k.Label(), err)
+			continue
+		}
+		out = append(out, entry{Account: a})
+	}
+	return out
+}
+
+// importCommand uploads the keys from another app's backup to Authy, as new
+// tokens encrypted with the backup password.
+func importCommand(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	formatPtr := fs.String("format", "otpauth", "Format of the file to import: "+importFormatNames())
+	dryRunPtr := fs.Bool("dry-run", false, "Only show which tokens would be added")
+	issuersPtr := fs.String("issuers", "", "JSON file mapping Authy account types to issuer names, overriding the built-in ones")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: authy-export import [flags] <file>\n")
+		fs.PrintDefaults()
+	}
+	applyClientFlags := clientFlags(fs)
+	fs.Parse(args)
+	applyClientFlags()
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	issuers := loadIssuers(*issuersPtr)
+	keys := readImport(fs.Arg(0), *formatPtr)
+
+	regr, cl := deviceClient()
+	existing := fetchTokens(cl, regr)
+	pp := readBackupPassword()
+	template := newToken(existing, pp)
+
+	// Skip the keys which are already in Authy
+	have := map[string]bool{}
+	for _, tok := range existing.AuthenticatorTokens {
+		if secret, err := tok.Decrypt(string(pp)); err == nil {
+			if secret, err = authy.NormalizeSecret(secret); err == nil {
+				have[secret] = true
+			}
+		}
+	}
+
+	var added int
+	for _, k := range keys {
+		if err := authyCompatible(k); err != nil {
+			log.Printf("Skipping %s: %v", k.Label(), err)
+			continue
+		}
+		secret, err := authy.NormalizeSecret(k.Secret)
+		if err != nil {
+			log.Printf("Skipping %s: %v", k.Label(), err)
+			continue
+		}
+		if have[secret] {
+			log.Printf("Skipping %s: it is already in Authy", k.Label())
+			continue
+		}
+
+		tok := template
+		tok.Name = authy.Identity{Issuer: k.Issuer, Account: k.Account}.Label()
+		tok.OriginalName = tok.Name
+		tok.AccountType = issuers.AccountType(k.Issuer)
+		tok.Digits = k.Digits
+		if *dryRunPtr {
+			log.Printf("Would add token %s (%s, %d digits)", tok.Name, tok.AccountType, tok.Digits)
+			continue
+		}
+
+		if err := tok.Encrypt(secret, string(pp)); err != nil {
+			log.Printf("Skipping %s: %v", k.Label(), err)
+			continue
+		}
+		resp, err := cl.AddAuthenticatorToken(nil, regr.UserID, regr.DeviceID, regr.Seed, tok)
+		if err != nil {
+			log.Fatalf("Could not upload token %s: %v", tok.Name, err)
+		}
+		if !resp.Success {
+			log.Fatalf("Failed to upload token %s: %+v", tok.Name, resp)
+		}
+		log.Printf("Added token %s (%s)", tok.Name, resp.AuthenticatorToken.UniqueID)
+		have[secret] = true
+		added++
+	}
+	if !*dryRunPtr {
+		log.Printf("Added %d of %d tokens", added, len(keys))
+	}
+}
+
+// authyCompatible checks that a key can be stored as an Authy token, which
+// always has a period of 30 seconds and uses SHA1.
+func authyCompatible(k otpauth.Key) error {
+	switch {
+	case k.Type != otpauth.TypeTOTP:
+		return fmt.Errorf("Authy doesn't support %s keys", k.Type)
+	case k.Period != 30:
+		return fmt.Errorf("Authy doesn't support a period of %d seconds", k.Period)
+	case k.Algorithm != "SHA1":
+		return fmt.Errorf("Authy doesn't support the %s algorithm", k.Algorithm)
+	case k.Digits < 6 || k.Digits > 8:
+		return fmt.Errorf("Authy doesn't support %d digits", k.Digits)
+	}
+	return nil
+}
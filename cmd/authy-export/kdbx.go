@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+
+	"github.com/alexzorin/authy"
+	"github.com/alexzorin/authy/kdbx"
+)
+
+// The KeePass key file for the kdbx format, from --kdbx-key-file
+var kdbxKeyFile string
+
+// writeKDBX writes the entries to a KeePass database, grouped by issuer, with
+// their Key URIs in KeePassXC's otp attribute. The database password is
+// prompted for, and may be empty if a key file is used.
+func writeKDBX(w io.Writer, entries []entry) error {
+	var key kdbx.Key
+	if kdbxKeyFile != "" {
+		buf, err := ioutil.ReadFile(kdbxKeyFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read the key file: %v", err)
+		}
+		key.KeyFile = buf
+	}
+	if pp := readNewPassword("database password", key.KeyFile != nil); len(pp) > 0 {
+		key.Password = pp
+	}
+
+	db := kdbx.Database{Name: "Authy"}
+	for _, e := range entries {
+		if e.Err != nil {
+			log.Print(e.failure())
+			continue
+		}
+		title := e.Issuer
+		if title == "" {
+			title = e.Identity.Account
+		}
+		if e.Deleted {
+			title = deletedLabelPrefix + title
+		}
+		notes := fmt.Sprintf("Authy token %s", e.ID)
+		if e.Source == authy.SourceApp {
+			notes = fmt.Sprintf("Authy App %s", e.ID)
+		}
+		db.Entries = append(db.Entries, kdbx.Entry{
+			Group:    e.Issuer,
+			Title:    title,
+			UserName: e.Identity.Account,
+			Notes:    notes,
+			OTP:      e.uri(),
+			Tags:     e.Tags,
+		})
+	}
+
+	log.Printf("Writing %d tokens to the KeePass database", len(db.Entries))
+	return db.Write(w, key)
+}
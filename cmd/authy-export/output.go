@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/alexzorin/authy"
+)
+
+// outputFormat writes the exported entries in some format.
+type outputFormat struct {
+	write func(w io.Writer, entries []entry) error
+
+	// Binary formats are only written to files, not to the terminal
+	binary bool
+
+	// Whether the format can be password-protected with --encrypt
+	encryptable bool
+}
+
+// Whether to password-protect the export, from --encrypt
+var encryptExport bool
+
+// Output formats of the export, by the name given to --format.
+var formats = map[string]outputFormat{
+	"uri":       {write: printURIs},
+	"json":      {write: printJSON},
+	"kdbx":      {write: writeKDBX, binary: true},
+	"bitwarden": {write: writeBitwarden, encryptable: true},
+	"2fas":      {write: writeTwoFAS, encryptable: true},
+	"ente":      {write: writeEnte},
+}
+
+// jsonAccount is an entry in the JSON output.
+type jsonAccount struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Name        string   `json:"name"`
+	Issuer      string   `json:"issuer"`
+	Account     string   `json:"account"`
+	AccountType string   `json:"account_type"`
+	Digits      int      `json:"digits"`
+	Period      int      `json:"period"`
+	Algorithm   string   `json:"algorithm"`
+	Secret      string   `json:"secret,omitempty"`
+	URI         string   `json:"uri,omitempty"`
+	Weakness    string   `json:"weakness,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Deleted     bool     `json:"deleted"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// jsonSummary counts the entries in the JSON output.
+type jsonSummary struct {
+	Total   int `json:"total"`
+	Tokens  int `json:"tokens"`
+	Apps    int `json:"apps"`
+	Imports int `json:"imports"`
+	Deleted int `json:"deleted"`
+	Failed  int `json:"failed"`
+	Invalid int `json:"invalid"`
+}
+
+// jsonDocument is the JSON output.
+type jsonDocument struct {
+	Accounts []jsonAccount `json:"accounts"`
+	Summary  jsonSummary   `json:"summary"`
+}
+
+// newJSONDocument describes the entries, including those which couldn't be
+// decrypted or have invalid secrets, and counts them.
+func newJSONDocument(entries []entry) jsonDocument {
+	doc := jsonDocument{Accounts: []jsonAccount{}}
+	for _, e := range entries {
+		a := jsonAccount{
+			ID:          e.ID,
+			Type:        e.Source,
+			Name:        e.Name,
+			Issuer:      e.Issuer,
+			Account:     e.Identity.Account,
+			AccountType: e.AccountType,
+			Digits:      e.Digits,
+			Period:      e.Period,
+			Algorithm:   e.Algorithm,
+			Tags:        e.Tags,
+			Deleted:     e.Deleted,
+		}
+		doc.Summary.Total++
+		switch e.Source {
+		case authy.SourceApp:
+			doc.Summary.Apps++
+		case authy.SourceImport:
+			doc.Summary.Imports++
+		default:
+			doc.Summary.Tokens++
+		}
+		if e.Deleted {
+			doc.Summary.Deleted++
+		}
+		if e.Err != nil {
+			a.Error = e.Err.Error()
+			if e.invalid() {
+				doc.Summary.Invalid++
+			} else {
+				doc.Summary.Failed++
+			}
+		} else {
+			a.Secret = e.Secret
+			a.URI = e.uri()
+			a.Weakness = e.Weakness()
+		}
+		doc.Accounts = append(doc.Accounts, a)
+	}
+	return doc
+}
+
+// printJSON writes the entries as a single JSON document, along with a
+// summary.
+func printJSON(w io.Writer, entries []entry) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(newJSONDocument(entries))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy"
+)
+
+func TestNewJSONDocument(t *testing.T) {
+	b := testBackup(t)
+	entries := collectEntries(b.Tokens, b.Apps, []byte(testPassword), authy.DefaultIssuers, true)
+	entries = append(entries,
+		entry{Account: authy.Account{Source: authy.SourceImport, Name: "carol", Digits: 6, Period: 30, Algorithm: "SHA1"},
+			Err: &authy.InvalidSecretError{Reason: "it isn't base32"}},
+		entry{Account: authy.Account{Source: authy.SourceToken, ID: "3", Name: "dave", Digits: 6, Period: 30, Algorithm: "SHA1"},
+			Err: errors.New("wrong password")},
+	)
+
+	doc := newJSONDocument(entries)
+	expected := jsonSummary{Total: 6, Tokens: 3, Apps: 2, Imports: 1, Deleted: 2, Failed: 1, Invalid: 1}
+	if doc.Summary != expected {
+		t.Errorf("Got the summary %+v, expected %+v", doc.Summary, expected)
+	}
+	if len(doc.Accounts) != len(entries) {
+		t.Fatalf("Got %d accounts, expected %d", len(doc.Accounts), len(entries))
+	}
+
+	tok := doc.Accounts[0]
+	if tok.ID != "1" || tok.Type != "token" || tok.Issuer != "GitHub" || tok.Account != "alice" || tok.Secret != testSeed ||
+		!strings.HasPrefix(tok.URI, "otpauth://totp/GitHub:alice?") || tok.Error != "" {
+		t.Errorf("Unexpected token %+v", tok)
+	}
+	if deleted := doc.Accounts[2]; !deleted.Deleted || !strings.Contains(deleted.URI, "%5BDeleted%5D") {
+		t.Errorf("Unexpected deleted token %+v", deleted)
+	}
+	for _, failed := range doc.Accounts[4:] {
+		if failed.Error == "" || failed.Secret != "" || failed.URI != "" {
+			t.Errorf("Unexpected failed account %+v", failed)
+		}
+	}
+}
+
+func TestPrintJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := printJSON(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	// An empty export still has a list of accounts
+	if accounts, ok := doc["accounts"].([]interface{}); !ok || len(accounts) != 0 {
+		t.Errorf("Expected an empty list of accounts, got %s", buf.String())
+	}
+	if summary, ok := doc["summary"].(map[string]interface{}); !ok || summary["total"] != 0.0 {
+		t.Errorf("Expected an empty summary, got %s", buf.String())
+	}
+
+	// URIs aren't escaped for HTML
+	buf.Reset()
+	b := testBackup(t)
+	if err := printJSON(&buf, collectEntries(b.Tokens, b.Apps, []byte(testPassword), authy.DefaultIssuers, false)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "&issuer=") {
+		t.Errorf("The URIs are escaped: %s", buf.String())
+	}
+}
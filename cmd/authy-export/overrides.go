@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// override changes how the entries it matches are exported. Entries are
+// matched by ID, or by a case-insensitive glob pattern of their name in
+// Authy (e.g. "aws*"). Unset fields leave the entry as it is.
+type override struct {
+	// Which entries to match
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+
+	// Don't export the entry at all
+	Skip bool `yaml:"skip"`
+
+	// New account label
+	Rename string `yaml:"rename"`
+
+	Issuer    string `yaml:"issuer"`
+	Digits    int    `yaml:"digits"`
+	Period    int    `yaml:"period"`
+	Algorithm string `yaml:"algorithm"`
+
+	// Added to the tags of the entry, for formats that support them
+	Tags []string `yaml:"tags"`
+}
+
+// readOverrides reads a list of overrides from a YAML or JSON file.
+func readOverrides(filename string) ([]override, error) {
+	buf, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is also YAML. Unknown fields are rejected, so that a misspelled
+	// one isn't silently ignored.
+	var out []override
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+	if err := dec.Decode(&out); err != nil && err != io.EOF {
+		return nil, err
+	}
+	for i, o := range out {
+		if o.ID == "" && o.Name == "" {
+			return nil, fmt.Errorf("override %d must have an id or a name to match", i+1)
+		}
+		if o.Name != "" {
+			if _, err := path.Match(o.Name, ""); err != nil {
+				return nil, fmt.Errorf("override %d has an invalid name pattern: %v", i+1, err)
+			}
+		}
+		if o.Digits != 0 && (o.Digits < 6 || o.Digits > 10) {
+			return nil, fmt.Errorf("override %d has %d digits, which must be between 6 and 10", i+1, o.Digits)
+		}
+		if o.Period < 0 {
+			return nil, fmt.Errorf("override %d has a period of %d, which must be positive", i+1, o.Period)
+		}
+		switch strings.ToUpper(o.Algorithm) {
+		case "", "SHA1", "SHA256", "SHA512":
+		default:
+			return nil, fmt.Errorf("override %d has an unsupported algorithm: %s", i+1, o.Algorithm)
+		}
+	}
+	return out, nil
+}
+
+func (o override) matches(e entry) bool {
+	if o.ID != "" && o.ID != e.ID {
+		return false
+	}
+	if o.Name != "" {
+		if ok, _ := path.Match(strings.ToLower(o.Name), strings.ToLower(e.Name)); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// applyOverrides applies each matching override to the entries, in order,
+// and drops the skipped entries.
+func applyOverrides(entries []entry, overrides []override) []entry {
+	var out []entry
+	for _, e := range entries {
+		skip := false
+		for _, o := range overrides {
+			if !o.matches(e) {
+				continue
+			}
+			skip = skip || o.Skip
+			if o.Rename != "" {
+				e.Identity.Account = o.Rename
+			}
+			if o.Issuer != "" {
+				e.Issuer = o.Issuer
+			}
+			if o.Digits != 0 {
+				e.Digits = o.Digits
+			}
+			if o.Period != 0 {
+				e.Period = o.Period
+			}
+			if o.Algorithm != "" {
+				e.Algorithm = strings.ToUpper(o.Algorithm)
+			}
+			e.Tags = append(e.Tags, o.Tags...)
+		}
+		if !skip {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy"
+)
+
+// writeTemp writes contents to a file in a new temporary directory, which is
+// removed by the returned function.
+func writeTemp(t *testing.T, name, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "authy-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(contents), 0600); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return filename, func() { os.RemoveAll(dir) }
+}
+
+func TestReadOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		expected []override
+		err      string
+	}{
+		{
+			name: "yaml",
+			contents: `- name: "aws*"
+  issuer: Amazon Web Services
+  tags: [work]
+- id: "1001"
+  skip: true
+`,
+			expected: []override{
+				{Name: "aws*", Issuer: "Amazon Web Services", Tags: []string{"work"}},
+				{ID: "1001", Skip: true},
+			},
+		},
+		{
+			name:     "json",
+			contents: `[{"id": "1001", "rename": "alice", "digits": 8, "period": 60, "algorithm": "sha256"}]`,
+			expected: []override{{ID: "1001", Rename: "alice", Digits: 8, Period: 60, Algorithm: "sha256"}},
+		},
+		{name: "empty", contents: ""},
+		{name: "unknown field", contents: `[{"id": "1001", "renmae": "alice"}]`, err: "renmae"},
+		{name: "not a list", contents: `id: "1001"`, err: "unmarshal"},
+		{name: "no match", contents: `[{"rename": "alice"}]`, err: "override 1 must have an id or a name"},
+		{name: "bad pattern", contents: `[{"name": "aws["}]`, err: "invalid name pattern"},
+		{name: "too few digits", contents: `[{"id": "1", "digits": 5}]`, err: "5 digits"},
+		{name: "too many digits", contents: `[{"id": "1", "digits": 11}]`, err: "11 digits"},
+		{name: "negative period", contents: `[{"id": "1"}, {"id": "2", "period": -30}]`, err: "override 2 has a period of -30"},
+		{name: "algorithm", contents: `[{"id": "1", "algorithm": "md5"}]`, err: "unsupported algorithm: md5"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filename, cleanup := writeTemp(t, "overrides.yaml", tc.contents)
+			defer cleanup()
+
+			got, err := readOverrides(filename)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Expected an error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Got %+v, expected %+v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	newEntry := func(id, name string) entry {
+		return entry{Account: authy.Account{
+			ID: id, Name: name, Identity: authy.Identity{Account: name},
+			Digits: 6, Period: 30, Algorithm: "SHA1",
+		}}
+	}
+	entries := []entry{newEntry("1", "AWS prod"), newEntry("2", "aws staging"), newEntry("3", "GitHub")}
+	overrides := []override{
+		{Name: "AWS*", Issuer: "Amazon Web Services", Tags: []string{"work"}},
+		{ID: "2", Name: "aws*", Skip: true},
+		{ID: "3", Rename: "alice", Digits: 8, Period: 60, Algorithm: "sha256", Tags: []string{"personal"}},
+		{ID: "3", Tags: []string{"code"}},
+	}
+
+	got := applyOverrides(entries, overrides)
+	if len(got) != 2 || got[0].ID != "1" || got[1].ID != "3" {
+		t.Fatalf("Expected the second entry to be skipped, got %+v", got)
+	}
+	if got[0].Issuer != "Amazon Web Services" || got[0].Identity.Account != "AWS prod" || !reflect.DeepEqual(got[0].Tags, []string{"work"}) {
+		t.Errorf("Unexpected entry %+v", got[0])
+	}
+	if got[1].Identity.Account != "alice" || got[1].Issuer != "" || got[1].Digits != 8 || got[1].Period != 60 ||
+		got[1].Algorithm != "SHA256" || !reflect.DeepEqual(got[1].Tags, []string{"personal", "code"}) {
+		t.Errorf("Unexpected entry %+v", got[1])
+	}
+	if entries[2].Identity.Account != "GitHub" || entries[2].Tags != nil {
+		t.Error("The overrides modified the original entries")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexzorin/authy"
+)
+
+// We'll persist this to the filesystem so we don't need to
+// re-register the device every time
+type deviceRegistration struct {
+	UserID   uint64 `json:"user_id,omitempty"`
+	DeviceID uint64 `json:"device_id,omitempty"`
+	Seed     string `json:"seed,omitempty"`
+	APIKey   string `json:"api_key,omitempty"`
+
+	// PEM-encoded device RSA private key
+	PrivateKey string `json:"private_key,omitempty"`
+}
+
+func newInteractiveDeviceRegistration() (deviceRegistration, error) {
+	var regr deviceRegistration
+	// The first part of device registration requires the user's phone number that
+	// is attached to their Authy account
+	var phoneCC int
+	var phoneNumber string
+
+	var err error
+	sc := bufio.NewScanner(os.Stdin)
+	fmt.Print("\nWhat is your phone number's country code? (digits only): ")
+	if !sc.Scan() {
+		return regr, errors.New("Please provide a phone country code, e.g. 61")
+	}
+	if phoneCC, err = strconv.Atoi(strings.TrimSpace(sc.Text())); err != nil {
+		return regr, err
+	}
+	fmt.Print("\nWhat is your phone number? (digits only): ")
+	if !sc.Scan() {
+		return regr, errors.New("Please provide a phone country code, e.g. 12341234")
+	}
+	phoneNumber = strings.TrimSpace(sc.Text())
+	if err := sc.Err(); err != nil {
+		return regr, err
+	}
+
+	// Query the existence of the Authy account
+	cl, err := authy.NewClient(clientOpts...)
+	if err != nil {
+		return regr, nil
+	}
+	userStatus, err := cl.QueryUser(nil, phoneCC, phoneNumber)
+	if err != nil {
+		return regr, err
+	}
+	if !userStatus.IsActiveUser() {
+		return regr, errors.New("There doesn't seem to be an Authy account attached to that phone number")
+	}
+
+	// Begin a device registration using Authy app push notification
+	regStart, err := cl.RequestDeviceRegistration(nil, userStatus.AuthyID, authy.ViaMethodPush)
+	if err != nil {
+		return regr, err
+	}
+	if !regStart.Success {
+		return regr, fmt.Errorf("Authy did not accept the device registration request: %+v", regStart)
+	}
+
+	// Poll for a while until the user has responded to the device registration
+	var regPIN string
+	timeout := time.Now().Add(5 * time.Minute)
+	for {
+		if timeout.Before(time.Now()) {
+			return regr, errors.New("Gave up waiting for user to respond to Authy device registration request")
+		}
+
+		log.Printf("Checking device registration status (%s until we give up)", time.Until(timeout).Truncate(time.Second))
+
+		regStatus, err := cl.CheckDeviceRegistration(nil, userStatus.AuthyID, regStart.RequestID)
+		if err != nil {
+			return regr, err
+		}
+		if regStatus.Status == "accepted" {
+			regPIN = regStatus.PIN
+			break
+		} else if regStatus.Status != "pending" {
+			return regr, fmt.Errorf("Invalid status while waiting for device registration: %s", regStatus.Status)
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+
+	// We have the registration PIN, complete the registration
+	regComplete, err := cl.CompleteDeviceRegistration(nil, userStatus.AuthyID, regPIN)
+	if err != nil {
+		return regr, err
+	}
+	if regComplete.Device.SecretSeed == "" {
+		return regr, errors.New("Something went wrong completing the device registration")
+	}
+
+	regr.UserID = regComplete.AuthyID
+	regr.DeviceID = regComplete.Device.ID
+	regr.Seed = regComplete.Device.SecretSeed
+	regr.APIKey = regComplete.Device.APIKey
+
+	// The device key isn't needed for exports, so don't fail without it
+	if err := fetchDevicePrivateKey(cl, &regr); err != nil {
+		log.Printf("Could not fetch the device private key: %v", err)
+	}
+
+	// We have everything we need, persist it to disk
+	return regr, saveDeviceRegistration(regr)
+}
+
+// fetchDevicePrivateKey stores the RSA private key of the device in regr.
+func fetchDevicePrivateKey(cl *authy.Client, regr *deviceRegistration) error {
+	resp, err := cl.QueryDevicePrivateKey(nil, regr.DeviceID, regr.Seed)
+	if err != nil {
+		return err
+	}
+	if _, err := resp.AsPrivateKey(); err != nil {
+		return err
+	}
+	regr.PrivateKey = resp.PrivateKey
+	return nil
+}
+
+func saveDeviceRegistration(regr deviceRegistration) error {
+	regrPath, err := configPath()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(regrPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(regr)
+}
+
+func loadExistingDeviceRegistration() (deviceRegistration, error) {
+	regrPath, err := configPath()
+	if err != nil {
+		return deviceRegistration{}, err
+	}
+
+	f, err := os.Open(regrPath)
+	if err != nil {
+		return deviceRegistration{}, err
+	}
+	defer f.Close()
+
+	var regr deviceRegistration
+	return regr, json.NewDecoder(f).Decode(&regr)
+}
+
+func configPath() (string, error) {
+	// TODO: In Go 1.13, use os.UserConfigDir()
+	regrPath, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(regrPath, "authy-go.json"), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/alexzorin/authy"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var errSelectionCancelled = errors.New("Selection cancelled")
+
+// selectEntries shows a checklist of the entries on the terminal, and
+// returns those which the user leaves checked. Every entry starts checked.
+//
+// The checklist is drawn to stderr, so that stdout can still be redirected
+// to a file.
+func selectEntries(entries []entry) ([]entry, error) {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, errors.New("Selecting tokens needs an interactive terminal")
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to set up the terminal: %v", err)
+	}
+	defer terminal.Restore(fd, state)
+
+	// Use the alternate screen, so the checklist doesn't linger afterwards
+	fmt.Fprint(os.Stderr, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(os.Stderr, "\x1b[?25h\x1b[?1049l")
+
+	checked := make([]bool, len(entries))
+	for i := range checked {
+		checked[i] = true
+	}
+	cursor, top := 0, 0
+
+	buf := make([]byte, 8)
+	for {
+		// Keep the cursor in view
+		rows := 20
+		if _, h, err := terminal.GetSize(fd); err == nil && h > 3 {
+			rows = h - 3
+		}
+		if cursor < top {
+			top = cursor
+		} else if cursor >= top+rows {
+			top = cursor - rows + 1
+		}
+		drawChecklist(os.Stderr, entries, checked, cursor, top, rows)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		switch key := string(buf[:n]); key {
+		case "\x1b[A", "k":
+			if cursor > 0 {
+				cursor--
+			}
+		case "\x1b[B", "j":
+			if cursor < len(entries)-1 {
+				cursor++
+			}
+		case " ", "x":
+			checked[cursor] = !checked[cursor]
+		case "a":
+			// Check everything, or uncheck everything if it already is
+			all := true
+			for _, c := range checked {
+				all = all && c
+			}
+			for i := range checked {
+				checked[i] = !all
+			}
+		case "\r", "\n":
+			var out []entry
+			for i, e := range entries {
+				if checked[i] {
+					out = append(out, e)
+				}
+			}
+			return out, nil
+		case "q", "\x1b", "\x03", "\x04":
+			return nil, errSelectionCancelled
+		}
+	}
+}
+
+func drawChecklist(w io.Writer, entries []entry, checked []bool, cursor, top, rows int) {
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	count := 0
+	for _, c := range checked {
+		if c {
+			count++
+		}
+	}
+	fmt.Fprintf(&b, "Select tokens to export (%d of %d)\r\n", count, len(entries))
+	b.WriteString("up/down: move, space: toggle, a: all/none, enter: export, q: cancel\r\n")
+
+	for i := top; i < len(entries) && i < top+rows; i++ {
+		e := entries[i]
+		pointer, box := "  ", "[ ]"
+		if i == cursor {
+			pointer = "> "
+		}
+		if checked[i] {
+			box = "[x]"
+		}
+		desc := e.Label()
+		if e.Source == authy.SourceApp {
+			desc += " (Authy App)"
+		}
+		if e.invalid() {
+			desc += " (invalid secret)"
+		} else if e.Err != nil {
+			desc += " (undecryptable)"
+		}
+		fmt.Fprintf(&b, "%s%s %s\r\n", pointer, box, desc)
+	}
+	io.WriteString(w, b.String())
+}
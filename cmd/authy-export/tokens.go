@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/alexzorin/authy"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// addTokenCommand encrypts a TOTP seed with the backup password and uploads
+// it to Authy as a new token.
+func addTokenCommand(args []string) {
+	fs := flag.NewFlagSet("add-token", flag.ExitOnError)
+	namePtr := fs.String("name", "", "Name of the token (required)")
+	typePtr := fs.String("type", "", "Account type, which Authy uses to choose the icon (e.g. google, github)")
+	digitsPtr := fs.Int("digits", 6, "How many digits the TOTP codes have")
+	applyClientFlags := clientFlags(fs)
+	fs.Parse(args)
+	applyClientFlags()
+
+	if *namePtr == "" {
+		log.Fatal("Please provide the name of the token with --name")
+	}
+
+	regr, cl := deviceClient()
+
+	existing := fetchTokens(cl, regr)
+	pp := readBackupPassword()
+	tok := newToken(existing, pp)
+	tok.Name = *namePtr
+	tok.AccountType = *typePtr
+	tok.Digits = *digitsPtr
+
+	if err := tok.Encrypt(readSeed(), string(pp)); err != nil {
+		log.Fatalf("Failed to encrypt the token: %v", err)
+	}
+
+	resp, err := cl.AddAuthenticatorToken(nil, regr.UserID, regr.DeviceID, regr.Seed, tok)
+	if err != nil {
+		log.Fatalf("Could not upload the token: %v", err)
+	}
+	if !resp.Success {
+		log.Fatalf("Failed to upload the token: %+v", resp)
+	}
+	log.Printf("Added token %s (%s)", tok.Name, resp.AuthenticatorToken.UniqueID)
+}
+
+// newToken returns a token to be encrypted with the backup password pp.
+// New tokens need to be encrypted the same way as the existing ones, or the
+// Authy apps won't be able to decrypt them, so pp is checked against them.
+func newToken(existing authy.AuthenticatorTokensResponse, pp []byte) authy.AuthenticatorToken {
+	var tok authy.AuthenticatorToken
+	if len(existing.AuthenticatorTokens) > 0 {
+		ref := existing.AuthenticatorTokens[0]
+		if _, err := ref.Decrypt(string(pp)); err != nil {
+			log.Fatalf("The backup password could not decrypt existing token %s: %v", ref.Description(), err)
+		}
+		tok.KDFRounds = ref.KDFRounds
+		tok.PasswordTimestamp = ref.PasswordTimestamp
+	}
+	return tok
+}
+
+// readSeed reads a base32-encoded TOTP seed, prompting for it if stdin is
+// a terminal. It is never taken from the command line, to keep it out of
+// shell history.
+func readSeed() string {
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		log.Printf("Please provide the base32-encoded TOTP seed: ")
+		seed, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		if err != nil {
+			log.Fatalf("Failed to read the seed: %v", err)
+		}
+		return string(seed)
+	}
+	sc := bufio.NewScanner(os.Stdin)
+	if !sc.Scan() {
+		log.Fatalf("Failed to read the seed: %v", sc.Err())
+	}
+	return strings.TrimSpace(sc.Text())
+}
+
+// tokenCommand returns a command which changes the token named by its first
+// argument, passing the remaining arguments to change.
+func tokenCommand(name, usage string, nargs int,
+	change func(cl *authy.Client, regr deviceRegistration, tok authy.AuthenticatorToken, args []string)) func([]string) {
+	return func(args []string) {
+		fs := flag.NewFlagSet(name, flag.ExitOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: authy-export %s %s\n", name, usage)
+			fs.PrintDefaults()
+		}
+		applyClientFlags := clientFlags(fs)
+		fs.Parse(args)
+		applyClientFlags()
+		if fs.NArg() != nargs+1 {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		regr, cl := deviceClient()
+		resp := fetchTokens(cl, regr)
+
+		tok, err := findToken(resp.AuthenticatorTokens, fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		change(cl, regr, tok, fs.Args()[1:])
+	}
+}
+
+// noTokenError is returned by findToken when no token matches.
+type noTokenError string
+
+func (e noTokenError) Error() string {
+	return fmt.Sprintf("No token matches %q", string(e))
+}
+
+// findToken finds the token with the unique ID or name ref. Names are
+// matched case-insensitively, and must be unambiguous.
+func findToken(tokens []authy.AuthenticatorToken, ref string) (authy.AuthenticatorToken, error) {
+	var matches []authy.AuthenticatorToken
+	for _, tok := range tokens {
+		if tok.UniqueID == ref {
+			return tok, nil
+		}
+		if strings.EqualFold(tok.Name, ref) || strings.EqualFold(tok.Description(), ref) {
+			matches = append(matches, tok)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return authy.AuthenticatorToken{}, noTokenError(ref)
+	case 1:
+		return matches[0], nil
+	}
+	var ids []string
+	for _, tok := range matches {
+		ids = append(ids, tok.UniqueID)
+	}
+	return authy.AuthenticatorToken{}, fmt.Errorf("%q matches several tokens, please use one of their IDs: %s",
+		ref, strings.Join(ids, ", "))
+}
+
+var renameCommand = tokenCommand("rename", "<token> <new name>", 1,
+	func(cl *authy.Client, regr deviceRegistration, tok authy.AuthenticatorToken, args []string) {
+		tok.Name = args[0]
+		updateToken(cl, regr, tok)
+	})
+
+var setTypeCommand = tokenCommand("set-type", "<token> <account type>", 1,
+	func(cl *authy.Client, regr deviceRegistration, tok authy.AuthenticatorToken, args []string) {
+		tok.AccountType = args[0]
+		updateToken(cl, regr, tok)
+	})
+
+var deleteCommand = tokenCommand("delete", "<token>", 0,
+	func(cl *authy.Client, regr deviceRegistration, tok authy.AuthenticatorToken, args []string) {
+		resp, err := cl.DeleteAuthenticatorToken(nil, regr.UserID, regr.DeviceID, regr.Seed, tok.UniqueID)
+		if err != nil {
+			log.Fatalf("Could not delete token %s: %v", tok.Description(), err)
+		}
+		if !resp.Success {
+			log.Fatalf("Failed to delete token %s: %+v", tok.Description(), resp)
+		}
+		log.Printf("Deleted token %s (%s)", tok.Description(), tok.UniqueID)
+	})
+
+// restoreCommand restores a recently deleted token or Authy App.
+func restoreCommand(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: authy-export restore <deleted token or app>\n")
+		fs.PrintDefaults()
+	}
+	applyClientFlags := clientFlags(fs)
+	fs.Parse(args)
+	applyClientFlags()
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	ref := fs.Arg(0)
+
+	regr, cl := deviceClient()
+	tokens := fetchTokens(cl, regr)
+
+	if tok, err := findToken(tokens.Deleted, ref); err == nil {
+		resp, err := cl.RestoreAuthenticatorToken(nil, regr.UserID, regr.DeviceID, regr.Seed, tok.UniqueID)
+		if err != nil {
+			log.Fatalf("Could not restore token %s: %v", tok.Description(), err)
+		}
+		if !resp.Success {
+			log.Fatalf("Failed to restore token %s: %+v", tok.Description(), resp)
+		}
+		log.Printf("Restored token %s (%s)", tok.Description(), tok.UniqueID)
+		return
+	} else if _, ok := err.(noTokenError); !ok {
+		log.Fatal(err)
+	}
+
+	apps := fetchApps(cl, regr)
+	for _, app := range apps.Deleted {
+		if app.ID != ref && !strings.EqualFold(app.Name, ref) {
+			continue
+		}
+		resp, err := cl.RestoreAuthenticatorApp(nil, regr.UserID, regr.DeviceID, regr.Seed, app.ID)
+		if err != nil {
+			log.Fatalf("Could not restore app %s: %v", app.Name, err)
+		}
+		if !resp.Success {
+			log.Fatalf("Failed to restore app %s: %+v", app.Name, resp)
+		}
+		log.Printf("Restored app %s (%s)", app.Name, app.ID)
+		return
+	}
+	log.Fatalf("No deleted token or app matches %q", ref)
+}
+
+// updateToken uploads the changes to a token. It is logged by its new name,
+// since Description prefers the name it was added with.
+func updateToken(cl *authy.Client, regr deviceRegistration, tok authy.AuthenticatorToken) {
+	name := tok.Name
+	if name == "" {
+		name = tok.Description()
+	}
+	resp, err := cl.UpdateAuthenticatorToken(nil, regr.UserID, regr.DeviceID, regr.Seed, tok)
+	if err != nil {
+		log.Fatalf("Could not update token %s: %v", name, err)
+	}
+	if !resp.Success {
+		log.Fatalf("Failed to update token %s: %+v", name, resp)
+	}
+	log.Printf("Updated token %s (%s)", name, tok.UniqueID)
+}
+
+// rotatePasswordCommand re-encrypts all tokens with a new backup password.
+func rotatePasswordCommand(args []string) {
+	fs := flag.NewFlagSet("rotate-password", flag.ExitOnError)
+	applyClientFlags := clientFlags(fs)
+	fs.Parse(args)
+	applyClientFlags()
+
+	regr, cl := deviceClient()
+
+	if deleted := fetchTokens(cl, regr).Deleted; len(deleted) > 0 {
+		var names []string
+		for _, tok := range deleted {
+			names = append(names, tok.Description())
+		}
+		log.Printf("Warning: deleted tokens can't be updated, so these will stay encrypted with "+
+			"the old password, and can't be restored with the new one: %s", strings.Join(names, ", "))
+	}
+
+	oldPP := readBackupPassword()
+	newPP := readNewPassword("new backup password", false)
+
+	if err := authy.RotateBackupPassword(nil, cl, regr.UserID, regr.DeviceID, regr.Seed,
+		string(oldPP), string(newPP)); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("All tokens are now encrypted with the new backup password")
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"log"
+
+	"github.com/alexzorin/authy/twofas"
+)
+
+// writeTwoFAS writes the entries as a 2FAS backup, with their first tag as
+// their group. Tokens which 2FAS can't represent, such as Authy Apps with
+// their 10 second period, are left out and reported. With --encrypt, the
+// backup is password-protected.
+func writeTwoFAS(w io.Writer, entries []entry) error {
+	var services []twofas.Service
+	var groups []twofas.Group
+	groupIDs := map[string]string{}
+	for _, e := range entries {
+		if e.Err != nil {
+			log.Print(e.failure())
+			continue
+		}
+		name := e.Issuer
+		if name == "" {
+			name = e.Identity.Account
+		}
+		if e.Deleted {
+			name = deletedLabelPrefix + name
+		}
+		svc, err := twofas.NewService(name, e.Secret, twofas.OTP{
+			Label:     e.Label(),
+			Account:   e.Identity.Account,
+			Issuer:    e.Issuer,
+			Digits:    e.Digits,
+			Period:    e.Period,
+			Algorithm: e.Algorithm,
+		})
+		if err != nil {
+			log.Printf("Leaving out %s %s: %v", e.Source, e.Name, err)
+			continue
+		}
+
+		if len(e.Tags) > 0 {
+			tag := e.Tags[0]
+			if _, ok := groupIDs[tag]; !ok {
+				g, err := twofas.NewGroup(tag)
+				if err != nil {
+					return err
+				}
+				groups = append(groups, g)
+				groupIDs[tag] = g.ID
+			}
+			id := groupIDs[tag]
+			svc.GroupID = &id
+			if len(e.Tags) > 1 {
+				log.Printf("2FAS only has one group per token, so %s is only in %s", e.Name, tag)
+			}
+		}
+		services = append(services, svc)
+	}
+
+	backup := twofas.NewBackup(services, groups)
+	if !encryptExport {
+		return backup.Write(w)
+	}
+	pp := readNewPassword("2FAS backup password", false)
+	return backup.WriteEncrypted(w, string(pp))
+}
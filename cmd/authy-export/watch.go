@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// watchCommand shows the current codes of the accounts, with the time left
+// until they change, updating them as they do.
+func watchCommand(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: authy-export watch [flags]\n")
+		fs.PrintDefaults()
+	}
+	loadAccounts := accountFlags(fs)
+	applyClientFlags := clientFlags(fs)
+	fs.Parse(args)
+	applyClientFlags()
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	entries := loadAccounts()
+	if len(entries) == 0 {
+		log.Fatal("There are no tokens to watch")
+	}
+	if err := watchEntries(entries); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// watchState is what the watch screen shows, besides the codes.
+type watchState struct {
+	// The entries matching query, and the one under the cursor
+	visible []entry
+	cursor  int
+	top     int
+
+	// Whether keys are typed into the query, rather than being commands
+	searching bool
+	query     string
+
+	// A message about the last action
+	status string
+
+	// Where the OSC 52 sequences that copy codes are written
+	clipboard io.Writer
+}
+
+// watchEntries shows the entries' codes on the terminal until the user
+// quits. Typing / searches the entries, and enter copies the code under the
+// cursor to the clipboard, using OSC 52 so it works over SSH too.
+//
+// Like the checklist of --select, the screen is drawn to stderr.
+func watchEntries(entries []entry) error {
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return errors.New("Watching tokens needs an interactive terminal")
+	}
+
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("Failed to set up the terminal: %v", err)
+	}
+	defer terminal.Restore(fd, state)
+
+	fmt.Fprint(os.Stderr, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(os.Stderr, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- string(buf[:n])
+		}
+	}()
+
+	// Redraw often enough for the countdowns to tick smoothly
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+
+	s := watchState{visible: entries, clipboard: os.Stderr}
+	for {
+		rows := 20
+		if _, h, err := terminal.GetSize(fd); err == nil && h > 4 {
+			rows = h - 4
+		}
+		if s.cursor < s.top {
+			s.top = s.cursor
+		} else if s.cursor >= s.top+rows {
+			s.top = s.cursor - rows + 1
+		}
+		drawWatch(os.Stderr, s, rows, time.Now())
+
+		select {
+		case <-ticker.C:
+			continue
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if quit := s.handleKey(key, entries); quit {
+				return nil
+			}
+		}
+	}
+}
+
+// handleKey updates the state for a key press, and reports whether the
+// user quit.
+func (s *watchState) handleKey(key string, entries []entry) bool {
+	s.status = ""
+	switch key {
+	case "\x03", "\x04":
+		return true
+	case "\x1b[A":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+		return false
+	case "\x1b[B":
+		if s.cursor < len(s.visible)-1 {
+			s.cursor++
+		}
+		return false
+	case "\r", "\n":
+		if s.searching {
+			s.searching = false
+		} else {
+			s.copyCode()
+		}
+		return false
+	case "\x1b":
+		if s.searching || s.query != "" {
+			s.searching = false
+			s.setQuery("", entries)
+			return false
+		}
+		return true
+	}
+
+	if s.searching {
+		switch key {
+		case "\x7f", "\b":
+			if _, size := utf8.DecodeLastRuneInString(s.query); size > 0 {
+				s.setQuery(s.query[:len(s.query)-size], entries)
+			}
+		default:
+			query := s.query
+			for _, r := range key {
+				if unicode.IsPrint(r) {
+					query += string(r)
+				}
+			}
+			s.setQuery(query, entries)
+		}
+		return false
+	}
+
+	switch key {
+	case "k":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case "j":
+		if s.cursor < len(s.visible)-1 {
+			s.cursor++
+		}
+	case "/":
+		s.searching = true
+	case "c", "y":
+		s.copyCode()
+	case "q":
+		return true
+	}
+	return false
+}
+
+// setQuery shows only the entries whose name or label fuzzily match query.
+func (s *watchState) setQuery(query string, entries []entry) {
+	s.query = query
+	s.visible = nil
+	for _, e := range entries {
+		if fuzzyMatch(query, e.Name) || fuzzyMatch(query, e.Label()) {
+			s.visible = append(s.visible, e)
+		}
+	}
+	s.cursor, s.top = 0, 0
+}
+
+// copyCode copies the code under the cursor to the clipboard, with the OSC
+// 52 escape sequence, which the terminal emulator handles.
+func (s *watchState) copyCode() {
+	if len(s.visible) == 0 {
+		return
+	}
+	e := s.visible[s.cursor]
+	if e.Err != nil {
+		s.status = e.failure()
+		return
+	}
+	code, err := e.Code(time.Now())
+	if err != nil {
+		s.status = fmt.Sprintf("Failed to generate the code of %s: %v", e.Label(), err)
+		return
+	}
+	fmt.Fprintf(s.clipboard, "\x1b]52;c;%s\x07", base64.StdEncoding.EncodeToString([]byte(code)))
+	s.status = fmt.Sprintf("Copied the code of %s", e.Label())
+}
+
+// The width of the countdown bars, in characters
+const countdownWidth = 15
+
+// countdown returns the seconds left until the code of a period changes, and
+// how many characters of the countdown bar they fill, rounded up.
+func countdown(period int, now time.Time) (left, filled int) {
+	left = period - int(now.Unix()%int64(period))
+	return left, (left*countdownWidth + period - 1) / period
+}
+
+func drawWatch(w io.Writer, s watchState, rows int, now time.Time) {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+
+	switch {
+	case s.searching:
+		fmt.Fprintf(&b, "Search: %s_", s.query)
+	case s.query != "":
+		fmt.Fprintf(&b, "Search: %s (esc to clear)", s.query)
+	default:
+		b.WriteString("Up/down to move, enter to copy, / to search, q to quit")
+	}
+	b.WriteString("\x1b[K\r\n\x1b[K\r\n")
+
+	labelWidth := 0
+	for _, e := range s.visible {
+		if n := utf8.RuneCountInString(e.Label()); n > labelWidth {
+			labelWidth = n
+		}
+	}
+	if labelWidth > 40 {
+		labelWidth = 40
+	}
+
+	for i := s.top; i < len(s.visible) && i < s.top+rows; i++ {
+		e := s.visible[i]
+		pointer := "  "
+		if i == s.cursor {
+			pointer = "> "
+		}
+		label := []rune(e.Label())
+		if len(label) > labelWidth {
+			label = append(label[:labelWidth-1], '~')
+		}
+		fmt.Fprintf(&b, "%s%-*s  ", pointer, labelWidth, string(label))
+
+		code, err := e.Code(now)
+		switch {
+		case e.invalid():
+			b.WriteString("(invalid secret)")
+		case e.Err != nil:
+			b.WriteString("(undecryptable)")
+		case err != nil:
+			b.WriteString("(invalid)")
+		default:
+			// Count down to the next period, in red when it's nearly over
+			left, filled := countdown(e.Period, now)
+			color := ""
+			if left*6 <= e.Period {
+				color = "\x1b[31m"
+			}
+			fmt.Fprintf(&b, "%s%-8s %s%s %2ds\x1b[0m", color, code,
+				strings.Repeat("█", filled), strings.Repeat("░", countdownWidth-filled), left)
+		}
+		b.WriteString("\x1b[K\r\n")
+	}
+	if len(s.visible) == 0 {
+		b.WriteString("  No tokens match\x1b[K\r\n")
+	}
+	fmt.Fprintf(&b, "\x1b[K\r\n%s\x1b[K\x1b[J", s.status)
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexzorin/authy"
+)
+
+// The secret of the RFC 6238 test vectors, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// totpEntry returns an entry named "issuer: account" with the RFC 6238
+// secret.
+func totpEntry(id, issuer, account string, period int) entry {
+	return entry{Account: authy.Account{
+		Source:    authy.SourceToken,
+		ID:        id,
+		Name:      issuer + ": " + account,
+		Identity:  authy.Identity{Issuer: issuer, Account: account},
+		Secret:    rfcSecret,
+		Digits:    6,
+		Period:    period,
+		Algorithm: "SHA1",
+	}}
+}
+
+func watchEntriesForTest() []entry {
+	failed := totpEntry("3", "Google", "carol", 30)
+	failed.Secret, failed.Err = "", errors.New("wrong password")
+	return []entry{
+		totpEntry("1", "GitHub", "alice", 30),
+		totpEntry("2", "GitHub", "bob", 30),
+		failed,
+		totpEntry("4", "Twitch", "Twitch", 10),
+	}
+}
+
+// labels returns the labels of the visible entries.
+func labels(s watchState) string {
+	var out []string
+	for _, e := range s.visible {
+		out = append(out, e.Label())
+	}
+	return strings.Join(out, ", ")
+}
+
+func TestWatchHandleKey(t *testing.T) {
+	entries := watchEntriesForTest()
+	var clipboard bytes.Buffer
+	s := watchState{visible: entries, clipboard: &clipboard}
+
+	// Moving stops at either end
+	for _, step := range []struct {
+		key    string
+		cursor int
+	}{
+		{"k", 0}, {"\x1b[A", 0}, {"j", 1}, {"\x1b[B", 2}, {"j", 3}, {"j", 3}, {"\x1b[A", 2}, {"k", 1},
+	} {
+		if s.handleKey(step.key, entries) || s.cursor != step.cursor {
+			t.Fatalf("After %q, the cursor is at %d, expected %d", step.key, s.cursor, step.cursor)
+		}
+	}
+
+	// Searching
+	for _, key := range []string{"/", "g", "h", "\t", "q", "é"} {
+		if s.handleKey(key, entries) {
+			t.Fatalf("%q quit while searching", key)
+		}
+	}
+	if !s.searching || s.query != "ghqé" || labels(s) != "" {
+		t.Fatalf("Unexpected search %q, showing %s", s.query, labels(s))
+	}
+	s.handleKey("\x7f", entries)
+	s.handleKey("\b", entries)
+	if s.query != "gh" || labels(s) != "GitHub:alice, GitHub:bob" || s.cursor != 0 {
+		t.Fatalf("Unexpected search %q, showing %s at %d", s.query, labels(s), s.cursor)
+	}
+	s.handleKey("\r", entries)
+	if s.searching || s.query != "gh" {
+		t.Fatalf("Enter should end the search, keeping the query %q", s.query)
+	}
+	s.handleKey("j", entries)
+	if s.cursor != 1 {
+		t.Error("The keys should move the cursor once the search has ended")
+	}
+
+	// Escape clears the search, then quits
+	if s.handleKey("\x1b", entries) || s.query != "" || len(s.visible) != len(entries) || s.cursor != 0 {
+		t.Fatalf("Escape should clear the search, got %q showing %s", s.query, labels(s))
+	}
+	if !s.handleKey("\x1b", entries) {
+		t.Error("Escape without a search should quit")
+	}
+	for _, key := range []string{"q", "\x03", "\x04"} {
+		if !(&watchState{visible: entries}).handleKey(key, entries) {
+			t.Errorf("%q should quit", key)
+		}
+	}
+	if !(&watchState{visible: entries, searching: true}).handleKey("\x03", entries) {
+		t.Error("Ctrl-C should quit while searching")
+	}
+}
+
+func TestWatchCopyCode(t *testing.T) {
+	entries := watchEntriesForTest()
+	var clipboard bytes.Buffer
+	s := watchState{visible: entries, clipboard: &clipboard}
+
+	for _, key := range []string{"\r", "c", "y"} {
+		clipboard.Reset()
+		s.handleKey(key, entries)
+		out := clipboard.String()
+		if !strings.HasPrefix(out, "\x1b]52;c;") || !strings.HasSuffix(out, "\x07") {
+			t.Fatalf("%q wrote %q, expected an OSC 52 sequence", key, out)
+		}
+		code, err := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(out, "\x1b]52;c;"), "\x07"))
+		if err != nil || len(code) != 6 {
+			t.Errorf("%q copied %q, %v", key, code, err)
+		}
+		if s.status != "Copied the code of GitHub:alice" {
+			t.Errorf("Unexpected status %q", s.status)
+		}
+	}
+
+	// Entries without secrets can't be copied
+	clipboard.Reset()
+	s.cursor = 2
+	s.handleKey("c", entries)
+	if clipboard.Len() != 0 || s.status != "Failed to decrypt token Google: carol: wrong password" {
+		t.Errorf("Copied %q, with the status %q", clipboard.String(), s.status)
+	}
+	// The status is cleared by the next key
+	s.handleKey("k", entries)
+	if s.status != "" {
+		t.Errorf("The status %q wasn't cleared", s.status)
+	}
+
+	// Nor can nothing
+	s.setQuery("zzz", entries)
+	s.handleKey("c", entries)
+	if clipboard.Len() != 0 || s.status != "" {
+		t.Errorf("Copied %q with nothing visible, with the status %q", clipboard.String(), s.status)
+	}
+}
+
+func TestWatchSetQuery(t *testing.T) {
+	entries := watchEntriesForTest()
+	s := watchState{visible: entries, cursor: 3, top: 2}
+	tests := map[string]string{
+		"":       "GitHub:alice, GitHub:bob, Google:carol, Twitch:Twitch",
+		"bob":    "GitHub:bob",
+		"GITHUB": "GitHub:alice, GitHub:bob",
+		"gca":    "Google:carol",
+		"g:ca":   "Google:carol",
+		"twtw":   "Twitch:Twitch",
+		"x":      "",
+	}
+	for query, expected := range tests {
+		s.setQuery(query, entries)
+		if got := labels(s); got != expected || s.cursor != 0 || s.top != 0 {
+			t.Errorf("setQuery(%q) shows %q at %d, %d, expected %q", query, got, s.cursor, s.top, expected)
+		}
+	}
+}
+
+func TestCountdown(t *testing.T) {
+	tests := []struct {
+		period int
+		now    int64
+		left   int
+		filled int
+	}{
+		{30, 30, 30, countdownWidth},
+		{30, 45, 15, 8},
+		{30, 59, 1, 1},
+		{10, 50, 10, countdownWidth},
+		{10, 55, 5, 8},
+		{10, 59, 1, 2},
+	}
+	for _, tc := range tests {
+		left, filled := countdown(tc.period, time.Unix(tc.now, 0))
+		if left != tc.left || filled != tc.filled {
+			t.Errorf("countdown(%d, %d) = %d, %d, expected %d, %d", tc.period, tc.now, left, filled, tc.left, tc.filled)
+		}
+	}
+}
+
+// watchLines draws the state and returns its lines, without escape
+// sequences.
+func watchLines(s watchState, rows int, now time.Time) []string {
+	var b bytes.Buffer
+	drawWatch(&b, s, rows, now)
+	out := b.String()
+	for _, seq := range []string{"\x1b[H", "\x1b[K", "\x1b[J", "\x1b[31m", "\x1b[0m"} {
+		out = strings.Replace(out, seq, "", -1)
+	}
+	return strings.Split(out, "\r\n")
+}
+
+func TestDrawWatch(t *testing.T) {
+	entries := watchEntriesForTest()
+	invalid := totpEntry("5", "Acme", "erin", 30)
+	invalid.Secret, invalid.Err = "", &authy.InvalidSecretError{Reason: "The secret is empty"}
+	long := totpEntry("6", "Amazon Web Services", "a-very-long-account-name@example.com", 30)
+	entries = append(entries, invalid, long)
+	s := watchState{visible: entries, cursor: 1, status: "Copied the code of GitHub:bob"}
+
+	// The token's period has 21s left, and the app's 1s
+	now := time.Unix(1111111119, 0)
+	appCode, err := entries[3].Code(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := watchLines(s, 20, now)
+	bar := func(filled int) string {
+		return strings.Repeat("█", filled) + strings.Repeat("░", countdownWidth-filled)
+	}
+	expected := []string{
+		"Up/down to move, enter to copy, / to search, q to quit",
+		"",
+		"  GitHub:alice                              050471   " + bar(11) + " 21s",
+		"> GitHub:bob                                050471   " + bar(11) + " 21s",
+		"  Google:carol                              (undecryptable)",
+		"  Twitch:Twitch                             " + appCode + "   " + bar(2) + "  1s",
+		"  Acme:erin                                 (invalid secret)",
+		"  Amazon Web Services:a-very-long-account~  050471   " + bar(11) + " 21s",
+		"",
+		"Copied the code of GitHub:bob",
+	}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Drew:\n%s\nexpected:\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+
+	// Only the countdowns which are nearly over are red
+	var b bytes.Buffer
+	drawWatch(&b, s, 20, now)
+	if n := strings.Count(b.String(), "\x1b[31m"); n != 1 || !strings.Contains(b.String(), "\x1b[31m"+appCode+"   "+bar(2)) {
+		t.Errorf("Expected only the app's countdown to be red, got %d red", n)
+	}
+
+	// Only the rows in view are drawn
+	s.top, s.cursor = 1, 2
+	lines = watchLines(s, 2, now)
+	if len(lines) != 6 || !strings.HasPrefix(lines[2], "  GitHub:bob") || !strings.HasPrefix(lines[3], "> Google:carol") {
+		t.Errorf("Drew rows %q", lines)
+	}
+
+	// Searching
+	s = watchState{searching: true, query: "zzz"}
+	lines = watchLines(s, 20, now)
+	if lines[0] != "Search: zzz_" || lines[2] != "  No tokens match" {
+		t.Errorf("Drew %q", lines)
+	}
+	s.searching = false
+	if lines = watchLines(s, 20, now); lines[0] != "Search: zzz (esc to clear)" {
+		t.Errorf("Drew %q", lines)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"math"
 	"strings"
@@ -25,9 +26,13 @@ const (
 	totpTimeStep = 10
 	totpDigits   = 7
 	kdfKeyLen    = 256
+
+	// DefaultKDFRounds is the number of PBKDF2 rounds used to encrypt new
+	// tokens, if the account has no existing tokens to take it from.
+	DefaultKDFRounds = 100000
 )
 
-func generateTOTPCodes(hexSecret string, digits int, timeStep int64, decodeBase32 bool) ([3]string, error) {
+func generateTOTPCodes(hexSecret string, digits int, timeStep int64, decodeBase32 bool, t time.Time) ([3]string, error) {
 	codes := [3]string{}
 
 	// Outer encoding is hex
@@ -45,11 +50,10 @@ func generateTOTPCodes(hexSecret string, digits int, timeStep int64, decodeBase3
 	}
 
 	// Generate 3 codes with timeStep
-	t := time.Now()
 	tDelta := time.Second * time.Duration(timeStep)
 
 	for i := range codes {
-		code, err := generateTOTP(decoded, t, digits, timeStep)
+		code, err := generateTOTP(sha1.New, decoded, t, digits, timeStep)
 		if err != nil {
 			return codes, err
 		}
@@ -61,14 +65,14 @@ func generateTOTPCodes(hexSecret string, digits int, timeStep int64, decodeBase3
 }
 
 // Largely copied from https://github.com/pquerna/otp/blob/master/hotp/hotp.go
-func generateTOTP(secret []byte, t time.Time, digits int, timeStep int64) (string, error) {
+func generateTOTP(newHash func() hash.Hash, secret []byte, t time.Time, digits int, timeStep int64) (string, error) {
 	t1 := t.Unix()
 	C := t1 / timeStep
 
 	cBuf := make([]byte, 8)
 	binary.BigEndian.PutUint64(cBuf, uint64(C))
 
-	mac := hmac.New(sha1.New, secret)
+	mac := hmac.New(newHash, secret)
 	mac.Write(cBuf)
 
 	H := mac.Sum(nil)
@@ -85,11 +89,18 @@ func generateTOTP(secret []byte, t time.Time, digits int, timeStep int64) (strin
 	return fmt.Sprintf(f, mod), nil
 }
 
-func decryptToken(kdfRounds int, encryptedSeedB64, salt, passphrase string) (string, error) {
+func decryptToken(kdfRounds int, encryptedSeedB64, salt, ivHex, passphrase string) (string, error) {
 	encryptedSeed, err := base64.StdEncoding.DecodeString(encryptedSeedB64)
 	if err != nil {
 		return "", fmt.Errorf("Error decoding encrypted seed: %v", err)
 	}
+	if len(encryptedSeed) == 0 || len(encryptedSeed)%aes.BlockSize != 0 {
+		return "", errors.New("decryption failed")
+	}
+	iv, err := tokenIV(ivHex)
+	if err != nil {
+		return "", err
+	}
 
 	k := pbkdf2.Key([]byte(passphrase), []byte(salt), kdfRounds, kdfKeyLen/8, sha1.New)
 
@@ -97,8 +108,6 @@ func decryptToken(kdfRounds int, encryptedSeedB64, salt, passphrase string) (str
 	if err != nil {
 		return "", err
 	}
-	// IV is all zeros
-	iv := make([]byte, aes.BlockSize)
 	cbc := cipher.NewCBCDecrypter(blk, iv)
 
 	out := make([]byte, len(encryptedSeed))
@@ -127,6 +136,48 @@ func decryptToken(kdfRounds int, encryptedSeedB64, salt, passphrase string) (str
 	return hex.EncodeToString(out[:paddingStart]), nil
 }
 
+// encryptToken is the inverse of decryptToken, encrypting the plaintext
+// seed with a key derived from passphrase and salt.
+func encryptToken(kdfRounds int, seed []byte, salt, ivHex, passphrase string) (string, error) {
+	iv, err := tokenIV(ivHex)
+	if err != nil {
+		return "", err
+	}
+
+	k := pbkdf2.Key([]byte(passphrase), []byte(salt), kdfRounds, kdfKeyLen/8, sha1.New)
+
+	blk, err := aes.NewCipher(k)
+	if err != nil {
+		return "", err
+	}
+	cbc := cipher.NewCBCEncrypter(blk, iv)
+
+	// Same padding scheme as decryptToken expects
+	paddingLen := aes.BlockSize - len(seed)%aes.BlockSize
+	plain := make([]byte, len(seed), len(seed)+paddingLen)
+	copy(plain, seed)
+	for i := 0; i < paddingLen; i++ {
+		plain = append(plain, byte(paddingLen))
+	}
+
+	out := make([]byte, len(plain))
+	cbc.CryptBlocks(out, plain)
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// tokenIV decodes the hex-encoded IV of a token. Older tokens don't have
+// one, in which case the IV is all zeros.
+func tokenIV(ivHex string) ([]byte, error) {
+	if ivHex == "" {
+		return make([]byte, aes.BlockSize), nil
+	}
+	iv, err := hex.DecodeString(ivHex)
+	if err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("Invalid IV")
+	}
+	return iv, nil
+}
+
 func randomBytes(byteSize int) ([]byte, error) {
 	buf := make([]byte, byteSize)
 	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
@@ -0,0 +1,214 @@
+package authy
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// DecryptRSAField decrypts a base64-encoded payload field that Authy
+// encrypted to a device's public key, such as encrypted sync data.
+//
+// Payloads are encrypted with RSA-OAEP (SHA-1), except for older ones which
+// use PKCS#1 v1.5 padding, so both are tried.
+func DecryptRSAField(pk *rsa.PrivateKey, encryptedB64 string) ([]byte, error) {
+	if pk == nil {
+		return nil, errors.New("No device private key")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encryptedB64)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding encrypted field: %v", err)
+	}
+	if out, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, pk, ciphertext, nil); err == nil {
+		return out, nil
+	}
+	out, err := rsa.DecryptPKCS1v15(rand.Reader, pk, ciphertext)
+	if err != nil {
+		return nil, errors.New("decryption failed")
+	}
+	return out, nil
+}
+
+// signRequest produces the base64-encoded device signature for a request
+// to the Authy API, for the endpoints which require one.
+//
+// The signed message is the method, the path (relative to the API root)
+// and the URL-encoded params sorted by key, separated by newlines. It is
+// signed using RSASSA-PKCS1-v1_5 with SHA-256.
+//
+// Authy's request signing isn't documented, and this scheme is a best guess
+// which hasn't been confirmed against the API, so it isn't exported.
+func signRequest(pk *rsa.PrivateKey, method, path string, params url.Values) (string, error) {
+	if pk == nil {
+		return "", errors.New("No device private key")
+	}
+	msg := strings.Join([]string{
+		strings.ToUpper(method),
+		strings.TrimPrefix(path, "/"),
+		params.Encode(),
+	}, "\n")
+	digest := sha256.Sum256([]byte(msg))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, pk, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// Device keys issued by Authy are 2048 bits, anything weaker is suspect.
+const minDeviceKeyBits = 2048
+
+// ParsePrivateKey parses a device RSA private key. It accepts PKCS#1 or
+// PKCS#8, either PEM-encoded or as bare base64 without the PEM headers,
+// and rejects keys that are inconsistent or smaller than 2048 bits.
+func ParsePrivateKey(key string) (*rsa.PrivateKey, error) {
+	key = strings.TrimSpace(key)
+
+	var der []byte
+	if strings.HasPrefix(key, "-----BEGIN") {
+		blk, _ := pem.Decode([]byte(key))
+		if blk == nil {
+			return nil, errors.New("Couldn't parse private key: invalid PEM")
+		}
+		der = blk.Bytes
+	} else {
+		var err error
+		der, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(key), ""))
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse private key: %v", err)
+		}
+	}
+
+	pk, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		parsed, err8 := x509.ParsePKCS8PrivateKey(der)
+		if err8 != nil {
+			return nil, fmt.Errorf("Couldn't parse private key: %v", err)
+		}
+		var ok bool
+		if pk, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("Couldn't parse private key: unexpected key type %T", parsed)
+		}
+	}
+
+	if err := pk.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid private key: %v", err)
+	}
+	if bits := pk.N.BitLen(); bits < minDeviceKeyBits {
+		return nil, fmt.Errorf("Invalid private key: %d bits is too small", bits)
+	}
+	return pk, nil
+}
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// ASN.1 structures of an encrypted PKCS#8 key (RFC 5208, RFC 8018)
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pbes2Algorithm
+	EncryptedData []byte
+}
+
+type pbes2Algorithm struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters pbes2Params
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pbkdf2Algorithm
+	EncryptionScheme  aesAlgorithm
+}
+
+type pbkdf2Algorithm struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters pbkdf2Params
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	PRF            pkix.AlgorithmIdentifier
+}
+
+type aesAlgorithm struct {
+	Algorithm asn1.ObjectIdentifier
+	IV        []byte
+}
+
+const pkcs8KDFRounds = 600000
+
+// MarshalEncryptedPKCS8 encodes pk as a passphrase-encrypted PKCS#8 PEM
+// block ("ENCRYPTED PRIVATE KEY"), using PBES2 with PBKDF2-HMAC-SHA256 and
+// AES-256-CBC, as OpenSSL does.
+func MarshalEncryptedPKCS8(pk *rsa.PrivateKey, passphrase []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := randomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := randomBytes(aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	k := pbkdf2.Key(passphrase, salt, pkcs8KDFRounds, 32, sha256.New)
+	blk, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	padLen := aes.BlockSize - len(der)%aes.BlockSize
+	plain := append(der, bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCBCEncrypter(blk, iv).CryptBlocks(encrypted, plain)
+
+	out, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm: pbes2Algorithm{
+			Algorithm: oidPBES2,
+			Parameters: pbes2Params{
+				KeyDerivationFunc: pbkdf2Algorithm{
+					Algorithm: oidPBKDF2,
+					Parameters: pbkdf2Params{
+						Salt:           salt,
+						IterationCount: pkcs8KDFRounds,
+						PRF: pkix.AlgorithmIdentifier{
+							Algorithm:  oidHMACWithSHA256,
+							Parameters: asn1.NullRawValue,
+						},
+					},
+				},
+				EncryptionScheme: aesAlgorithm{
+					Algorithm: oidAES256CBC,
+					IV:        iv,
+				},
+			},
+		},
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: out}), nil
+}
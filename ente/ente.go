@@ -0,0 +1,80 @@
+// Package ente writes encrypted exports of Ente Auth.
+//
+// An export is a list of Key URIs, one per line, encrypted with libsodium's
+// XChaCha20-Poly1305 secretstream under a key derived by Argon2id.
+package ente
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// The version of the export format
+const Version = 1
+
+// Export is an encrypted Ente Auth export.
+type Export struct {
+	Version         int       `json:"version"`
+	KDFParams       KDFParams `json:"kdfParams"`
+	EncryptedData   string    `json:"encryptedData"`
+	EncryptionNonce string    `json:"encryptionNonce"`
+}
+
+// KDFParams are the libsodium crypto_pwhash (Argon2id) parameters which the
+// key was derived with.
+type KDFParams struct {
+	// Memory in bytes
+	MemLimit int `json:"memLimit"`
+
+	// Iterations
+	OpsLimit int    `json:"opsLimit"`
+	Salt     string `json:"salt"`
+}
+
+// libsodium's "moderate" limits, which take under a second
+const (
+	defaultMemLimit = 256 * 1024 * 1024
+	defaultOpsLimit = 3
+	saltSize        = 16
+)
+
+// Encrypt returns an export of the Key URIs, encrypted with password.
+func Encrypt(uris []string, password string) (*Export, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	params := KDFParams{
+		MemLimit: defaultMemLimit,
+		OpsLimit: defaultOpsLimit,
+		Salt:     base64.StdEncoding.EncodeToString(salt),
+	}
+
+	header, ct, err := sealStream(params.key(password, salt), []byte(strings.Join(uris, "\n")))
+	if err != nil {
+		return nil, err
+	}
+	return &Export{
+		Version:         Version,
+		KDFParams:       params,
+		EncryptedData:   base64.StdEncoding.EncodeToString(ct),
+		EncryptionNonce: base64.StdEncoding.EncodeToString(header),
+	}, nil
+}
+
+// key derives the key as crypto_pwhash does, which uses a single lane.
+func (p KDFParams) key(password string, salt []byte) []byte {
+	return argon2.IDKey([]byte(password), salt, uint32(p.OpsLimit), uint32(p.MemLimit/1024), 1, 32)
+}
+
+// Write writes the export as JSON.
+func (e *Export) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
@@ -0,0 +1,85 @@
+package ente
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/poly1305"
+)
+
+// Message tags of libsodium's crypto_secretstream_xchacha20poly1305. The
+// final tag includes the rekey bit, so libsodium rekeys the stream after the
+// final message, which has no effect on a stream of one message.
+const (
+	tagPush  = 0x01
+	tagRekey = 0x02
+	tagFinal = tagPush | tagRekey
+)
+
+// The size of a stream's header
+const headerSize = 24
+
+// sealStream encrypts msg as the only, final message of a libsodium
+// crypto_secretstream_xchacha20poly1305 stream, and returns the stream's
+// header and the encrypted message.
+func sealStream(key, msg []byte) (header, out []byte, err error) {
+	header = make([]byte, headerSize)
+	if _, err := io.ReadFull(rand.Reader, header); err != nil {
+		return nil, nil, err
+	}
+	out, err = sealStreamWithHeader(key, header, msg)
+	return header, out, err
+}
+
+// sealStreamWithHeader is sealStream with a given header, which must be
+// random.
+func sealStreamWithHeader(key, header, msg []byte) ([]byte, error) {
+	subkey, err := chacha20.HChaCha20(key, header[:16])
+	if err != nil {
+		return nil, err
+	}
+	// The nonce is a counter, starting at 1, and the rest of the header
+	nonce := make([]byte, 12)
+	binary.LittleEndian.PutUint32(nonce, 1)
+	copy(nonce[4:], header[16:])
+
+	stream := func(counter uint32, dst, src []byte) error {
+		c, err := chacha20.NewUnauthenticatedCipher(subkey, nonce)
+		if err != nil {
+			return err
+		}
+		c.SetCounter(counter)
+		c.XORKeyStream(dst, src)
+		return nil
+	}
+
+	// Block 0 is the Poly1305 key, and block 1 encrypts the tag
+	var macKey [32]byte
+	if err := stream(0, macKey[:], macKey[:]); err != nil {
+		return nil, err
+	}
+	block := make([]byte, 64)
+	block[0] = tagFinal
+	if err := stream(1, block, block); err != nil {
+		return nil, err
+	}
+	ct := make([]byte, len(msg))
+	if err := stream(2, ct, msg); err != nil {
+		return nil, err
+	}
+
+	// There is no additional data. libsodium pads the ciphertext to
+	// (16 - 64 + len) & 15 bytes, rather than to a multiple of 16.
+	mac := poly1305.New(&macKey)
+	mac.Write(block)
+	mac.Write(ct)
+	mac.Write(make([]byte, (0x10-len(block)+len(ct))&0xf))
+	lens := make([]byte, 16)
+	binary.LittleEndian.PutUint64(lens[8:], uint64(len(block)+len(ct)))
+	mac.Write(lens)
+
+	out := append([]byte{block[0]}, ct...)
+	return mac.Sum(out), nil
+}
@@ -0,0 +1,150 @@
+package ente
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/chacha20"
+)
+
+func mustHex(s string) []byte {
+	buf, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+// Streams sealed by libsodium 1.0.18: crypto_secretstream_xchacha20poly1305
+// init_push, and a single push with TAG_FINAL and no additional data, with
+// the key 000102...1f. Pushing the final tag rekeys libsodium's state after
+// the message, so these also check that the rekey doesn't affect it.
+var streamVectors = []struct {
+	msg    string
+	header string
+	out    string
+}{
+	{
+		"",
+		"d15b870434ca1d8f95aab8a81a9589c89e1a1fa726c0e8c5",
+		"8d9a5c62a605c0c7d614077f5645305cd3",
+	},
+	{
+		"otpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP&issuer=GitHub",
+		"e27305c768935ff104d616475c7762667da4ce6c83ee4ced",
+		"50d418a7de2bb0ccfabcec4ef010e4ab498a22a1409755239d58c5f9dded473caf092bf371ddc01994e5947d90553979905e170db1a0ae88f25a930cf985be23e9e4d45d5652d39aac8767ddddf4a237c1b1",
+	},
+	{
+		strings.Join([]string{
+			"otpauth://totp/Example:user0?secret=JBSWY3DPEHPK3PXP",
+			"otpauth://totp/Example:user1?secret=JBSWY3DPEHPK3PXP",
+			"otpauth://totp/Example:user2?secret=JBSWY3DPEHPK3PXP",
+			"otpauth://totp/Example:user3?secret=JBSWY3DPEHPK3PXP",
+		}, "\n"),
+		"6840b88419a5f251c35e4ccd1cdfde73ad07af272e4c63d9",
+		"32ece464cc7b6219e9e3b8bd506d46904333eb8bc4cdaa374401dae57832296b41a05ef475eb6f73c3daffcb4f5f146d40e6e7f149011ea46362956efee1b3da22a13f841aafa4550dafb54e46de59a19579fcc962cd39ae810d2e675a2bbdf1c1eba6a9bf50ed6da09e3e4c8c5db797c07aa95710a57bc060746b42c6e61d81a0d705c383e53fefc78f8e4c830db283e26e6833df82088e2b8a27f03904f6830359b3fa500305dad67d1d3dd0f74d4fa449897eb2ddb691f1af996186eea33e5179de6bd15d35f1a4dc05aa811375ae7588c2df0fb34a3289b7660e9c75c387c2aad464",
+	},
+}
+
+func testKey() []byte {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	return key
+}
+
+func TestSealStreamKnownAnswers(t *testing.T) {
+	for _, v := range streamVectors {
+		out, err := sealStreamWithHeader(testKey(), mustHex(v.header), []byte(v.msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := mustHex(v.out); !bytes.Equal(out, expected) {
+			t.Errorf("%d byte message: got %x, expected %x", len(v.msg), out, expected)
+		}
+		// The tag, the message and the 16 byte MAC
+		if len(out) != 1+len(v.msg)+16 {
+			t.Errorf("%d byte message: got %d bytes", len(v.msg), len(out))
+		}
+	}
+}
+
+func TestSealStreamTag(t *testing.T) {
+	if tagFinal&tagRekey == 0 || tagFinal&tagPush == 0 {
+		t.Errorf("The final tag %#x should include the push and rekey bits", tagFinal)
+	}
+	// The tag is the first byte, encrypted with block 1 of the stream
+	for _, v := range streamVectors {
+		header := mustHex(v.header)
+		subkey, err := chacha20.HChaCha20(testKey(), header[:16])
+		if err != nil {
+			t.Fatal(err)
+		}
+		nonce := append([]byte{1, 0, 0, 0}, header[16:]...)
+		c, err := chacha20.NewUnauthenticatedCipher(subkey, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SetCounter(1)
+		tag := mustHex(v.out)[:1]
+		c.XORKeyStream(tag, tag)
+		if tag[0] != tagFinal {
+			t.Errorf("%d byte message: got tag %#x, expected %#x", len(v.msg), tag[0], tagFinal)
+		}
+	}
+}
+
+func TestSealStreamHeader(t *testing.T) {
+	header, out, err := sealStream(testKey(), []byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(header) != headerSize {
+		t.Fatalf("Got a %d byte header, expected %d", len(header), headerSize)
+	}
+	again, err := sealStreamWithHeader(testKey(), header, []byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, again) {
+		t.Error("The stream isn't sealed with the header that is returned")
+	}
+	// Headers are random, so the same message is sealed differently
+	header2, out2, err := sealStream(testKey(), []byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(header, header2) || bytes.Equal(out, out2) {
+		t.Error("Two streams have the same header")
+	}
+	// Both halves of the header matter: the first 16 bytes derive the
+	// subkey, and the last 8 are the nonce
+	for _, i := range []int{0, 15, 16, 23} {
+		h := append([]byte(nil), header...)
+		h[i] ^= 1
+		changed, err := sealStreamWithHeader(testKey(), h, []byte("message"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(changed, out) {
+			t.Errorf("Changing byte %d of the header didn't change the stream", i)
+		}
+	}
+}
+
+// Derived by libsodium's crypto_pwhash with crypto_pwhash_ALG_ARGON2ID13.
+func TestKDFParamsKey(t *testing.T) {
+	salt := make([]byte, saltSize)
+	for i := range salt {
+		salt[i] = byte(i)
+	}
+	p := KDFParams{MemLimit: 8 * 1024 * 1024, OpsLimit: 2}
+	key := p.key("hunter2", salt)
+	if got, expected := fmt.Sprintf("%x", key), "4681ceb0d90b7a7e940f71b8da7abe8a7c8c8ea2cb294679792dec1408875ae1"; got != expected {
+		t.Errorf("Got key %s, expected %s", got, expected)
+	}
+}
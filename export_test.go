@@ -0,0 +1,7 @@
+package authy
+
+// EncryptLegacy encrypts seed without validating it, like the tokens of
+// older apps, which Encrypt would reject.
+func (t *AuthenticatorToken) EncryptLegacy(seed, passphrase string) error {
+	return t.encryptSeed(seed, passphrase)
+}
@@ -0,0 +1,221 @@
+// Package googleauth reads the accounts that Google Authenticator exports
+// as migration QR codes, which encode otpauth-migration:// URIs.
+package googleauth
+
+import (
+	"bufio"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+// The fields of the MigrationPayload and OtpParameters protobuf messages
+const (
+	payloadOTPParameters = 1
+
+	paramSecret    = 1
+	paramName      = 2
+	paramIssuer    = 3
+	paramAlgorithm = 4
+	paramDigits    = 5
+	paramType      = 6
+	paramCounter   = 7
+)
+
+var (
+	algorithms = map[uint64]string{0: "SHA1", 1: "SHA1", 2: "SHA256", 3: "SHA512", 4: "MD5"}
+	digits     = map[uint64]int{0: 6, 1: 6, 2: 8}
+)
+
+const (
+	typeHOTP = 1
+	typeTOTP = 2
+)
+
+// Read reads the keys from a list of migration URIs, one per line, such as
+// the contents of several scanned QR codes. Blank lines are skipped. Keys
+// with unsupported parameters are left out, and reported with an
+// otpauth.UnsupportedError.
+func Read(r io.Reader) ([]otpauth.Key, error) {
+	var keys []otpauth.Key
+	var skipped []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		batch, err := ParseMigrationURI(line)
+		if uerr, ok := err.(*otpauth.UnsupportedError); ok {
+			skipped = append(skipped, uerr.Skipped...)
+		} else if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", n, err)
+		}
+		keys = append(keys, batch...)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(skipped) > 0 {
+		return keys, &otpauth.UnsupportedError{Skipped: skipped}
+	}
+	return keys, nil
+}
+
+// ParseMigrationURI returns the keys in an otpauth-migration:// URI. Keys
+// with unsupported parameters are left out, and reported with an
+// otpauth.UnsupportedError.
+func ParseMigrationURI(uri string) ([]otpauth.Key, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "otpauth-migration" {
+		return nil, fmt.Errorf("Not an otpauth-migration URI: %s", u.Scheme)
+	}
+	data := u.Query().Get("data")
+	// The data is often unescaped, turning + into a space
+	data = strings.Replace(data, " ", "+", -1)
+	payload, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		if payload, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "=")); err != nil {
+			return nil, fmt.Errorf("Failed to decode the migration data: %v", err)
+		}
+	}
+
+	var keys []otpauth.Key
+	var skipped []string
+	err = readMessage(payload, func(field int, varint uint64, bytes []byte) error {
+		if field != payloadOTPParameters || bytes == nil {
+			return nil
+		}
+		k, err := parseOTPParameters(bytes)
+		if uerr, ok := err.(*otpauth.UnsupportedError); ok {
+			skipped = append(skipped, uerr.Skipped...)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(skipped) > 0 {
+		return keys, &otpauth.UnsupportedError{Skipped: skipped}
+	}
+	return keys, nil
+}
+
+func parseOTPParameters(msg []byte) (otpauth.Key, error) {
+	k := otpauth.New("", "", "")
+	var name string
+	err := readMessage(msg, func(field int, varint uint64, bytes []byte) error {
+		switch field {
+		case paramSecret:
+			k.Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(bytes)
+		case paramName:
+			name = string(bytes)
+		case paramIssuer:
+			k.Issuer = string(bytes)
+		case paramAlgorithm:
+			k.Algorithm = algorithms[varint]
+		case paramDigits:
+			k.Digits = digits[varint]
+		case paramType:
+			if varint == typeHOTP {
+				k.Type = otpauth.TypeHOTP
+			}
+		case paramCounter:
+			k.Counter = varint
+		}
+		return nil
+	})
+	if err != nil {
+		return k, err
+	}
+	// Names are often "Issuer:account"
+	if i := strings.Index(name, ":"); i >= 0 {
+		if k.Issuer == "" {
+			k.Issuer = strings.TrimSpace(name[:i])
+		}
+		name = name[i+1:]
+	}
+	k.Account = strings.TrimSpace(name)
+	if k.Algorithm == "" || k.Digits == 0 {
+		return k, &otpauth.UnsupportedError{Skipped: []string{k.Label() + " (unknown algorithm or digits)"}}
+	}
+	return k, nil
+}
+
+var errTruncated = errors.New("The migration data is truncated")
+
+// readMessage decodes the fields of a protobuf message, calling fn with the
+// value of each varint field, or the bytes of each length-delimited field.
+func readMessage(msg []byte, fn func(field int, varint uint64, bytes []byte) error) error {
+	for len(msg) > 0 {
+		tag, n := readVarint(msg)
+		if n == 0 {
+			return errTruncated
+		}
+		msg = msg[n:]
+		field, wireType := int(tag>>3), tag&7
+
+		switch wireType {
+		case 0: // varint
+			v, n := readVarint(msg)
+			if n == 0 {
+				return errTruncated
+			}
+			msg = msg[n:]
+			if err := fn(field, v, nil); err != nil {
+				return err
+			}
+		case 2: // length-delimited
+			l, n := readVarint(msg)
+			if n == 0 || uint64(len(msg)-n) < l {
+				return errTruncated
+			}
+			b := msg[n : n+int(l)]
+			msg = msg[n+int(l):]
+			if err := fn(field, 0, b); err != nil {
+				return err
+			}
+		case 1: // 64-bit
+			if len(msg) < 8 {
+				return errTruncated
+			}
+			msg = msg[8:]
+		case 5: // 32-bit
+			if len(msg) < 4 {
+				return errTruncated
+			}
+			msg = msg[4:]
+		default:
+			return fmt.Errorf("Unsupported protobuf wire type %d", wireType)
+		}
+	}
+	return nil
+}
+
+// readVarint decodes a varint, returning it and its length, or a length of 0
+// if it is truncated.
+func readVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < len(b) && i < 10; i++ {
+		v |= uint64(b[i]&0x7f) << (7 * uint(i))
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
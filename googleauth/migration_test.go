@@ -0,0 +1,46 @@
+package googleauth
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+func TestRead(t *testing.T) {
+	f, err := os.Open("testdata/migration.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	keys, err := Read(f)
+
+	// The second batch has a key with an algorithm that isn't defined
+	uerr, ok := err.(*otpauth.UnsupportedError)
+	if !ok || len(uerr.Skipped) != 1 || !strings.Contains(uerr.Skipped[0], "Future:dave") {
+		t.Errorf("Expected the Future key to be skipped, got %v", err)
+	}
+	expected := []string{
+		"otpauth://totp/GitHub:alice?digits=6&issuer=GitHub&secret=JBSWY3DPEHPK3PXP",
+		"otpauth://hotp/Google:bob@example.com?counter=7&digits=6&issuer=Google&secret=GEZDGNBVGY3TQOJQ",
+		"otpauth://totp/Example:erin?algorithm=SHA256&digits=8&issuer=Example&secret=ONSWG4TFOQQGC4TF",
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Got %d keys, expected %d", len(keys), len(expected))
+	}
+	for i, k := range keys {
+		if k.URI() != expected[i] {
+			t.Errorf("Key %d: got %s, expected %s", i, k.URI(), expected[i])
+		}
+	}
+}
+
+func TestReadRejectsMalformed(t *testing.T) {
+	if _, err := Read(strings.NewReader("otpauth-migration://offline?data=CigKCkhl\n")); err == nil {
+		t.Error("Truncated migration data was read")
+	}
+	if _, err := Read(strings.NewReader("otpauth://totp/GitHub?secret=JBSWY3DPEHPK3PXP\n")); err == nil {
+		t.Error("A Key URI was read as a migration URI")
+	}
+}
@@ -0,0 +1,204 @@
+package authy
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// IssuerTable maps the identifiers that Authy uses for services, which are
+// the AccountType of tokens and the AssetsGroup of apps, to the names of the
+// services. Keys are lowercase.
+type IssuerTable map[string]string
+
+// DefaultIssuers is the built-in IssuerTable.
+var DefaultIssuers = IssuerTable{
+	"amazon":       "Amazon",
+	"atlassian":    "Atlassian",
+	"aws":          "Amazon Web Services",
+	"binance":      "Binance",
+	"bitbucket":    "Bitbucket",
+	"cloudflare":   "Cloudflare",
+	"coinbase":     "Coinbase",
+	"digitalocean": "DigitalOcean",
+	"discord":      "Discord",
+	"dropbox":      "Dropbox",
+	"evernote":     "Evernote",
+	"facebook":     "Facebook",
+	"gemini":       "Gemini",
+	"github":       "GitHub",
+	"gitlab":       "GitLab",
+	"google":       "Google",
+	"heroku":       "Heroku",
+	"instagram":    "Instagram",
+	"kraken":       "Kraken",
+	"lastpass":     "LastPass",
+	"linkedin":     "LinkedIn",
+	"microsoft":    "Microsoft",
+	"npm":          "npm",
+	"okta":         "Okta",
+	"paypal":       "PayPal",
+	"reddit":       "Reddit",
+	"sendgrid":     "SendGrid",
+	"slack":        "Slack",
+	"stripe":       "Stripe",
+	"twilio":       "Twilio",
+	"twitch":       "Twitch",
+	"twitter":      "Twitter",
+	"wordpress":    "WordPress",
+}
+
+// Account types which don't identify a service.
+var genericAccountTypes = map[string]bool{
+	"":              true,
+	"authenticator": true,
+	"generic":       true,
+	"other":         true,
+}
+
+// ReadIssuerTable reads an IssuerTable from a JSON object, such as
+// {"acme_corp": "ACME Corporation"}.
+func ReadIssuerTable(r io.Reader) (IssuerTable, error) {
+	var raw map[string]string
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	tbl := IssuerTable{}
+	for k, v := range raw {
+		tbl[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	return tbl, nil
+}
+
+// Merge returns a copy of tbl, with the entries of other added to it or
+// overriding its own.
+func (tbl IssuerTable) Merge(other IssuerTable) IssuerTable {
+	out := IssuerTable{}
+	for k, v := range tbl {
+		out[k] = v
+	}
+	for k, v := range other {
+		out[strings.ToLower(k)] = v
+	}
+	return out
+}
+
+// Name returns the name of the service with the identifier id, guessing it
+// from the identifier if it isn't in the table.
+func (tbl IssuerTable) Name(id string) string {
+	key := strings.ToLower(strings.TrimSpace(id))
+	if name, ok := tbl[key]; ok {
+		return name
+	}
+	// Identifiers are usually lowercase words separated by _ or -
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return r == '_' || r == '-' || unicode.IsSpace(r)
+	})
+	for i, w := range words {
+		r, n := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[n:]
+	}
+	return strings.Join(words, " ")
+}
+
+// AccountType returns the identifier of the service named issuer, for use as
+// the AccountType of a token, or "authenticator" if it isn't in the table.
+// If several identifiers have the name, the first in sorted order is used.
+func (tbl IssuerTable) AccountType(issuer string) string {
+	ids := make([]string, 0, len(tbl))
+	for id := range tbl {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if strings.EqualFold(tbl[id], strings.TrimSpace(issuer)) {
+			return id
+		}
+	}
+	return "authenticator"
+}
+
+// Identity is the issuer and account label of a token, which other
+// authenticator apps use to group and brand it.
+type Identity struct {
+	// The name of the service, empty if it couldn't be inferred
+	Issuer string
+
+	// The account at the service, e.g. a username or email address
+	Account string
+}
+
+// Label returns the label of the Key URI format, "Issuer:Account".
+func (id Identity) Label() string {
+	if id.Issuer == "" {
+		return id.Account
+	}
+	if id.Account == "" {
+		return id.Issuer
+	}
+	return id.Issuer + ":" + id.Account
+}
+
+// Token infers the Identity of a token from its name and account type.
+//
+// Token names are often "Issuer: account", "Issuer (account)" or
+// "account@issuer". Otherwise, the issuer is looked up from the token's
+// AccountType, unless that is generic.
+func (tbl IssuerTable) Token(tok AuthenticatorToken) Identity {
+	name := strings.TrimSpace(tok.OriginalName)
+	if name == "" {
+		name = strings.TrimSpace(tok.Name)
+	}
+
+	id := splitName(name)
+	if id.Issuer != "" {
+		// Prefer the canonical spelling, if the issuer is in the table
+		if canonical, ok := tbl[strings.ToLower(id.Issuer)]; ok {
+			id.Issuer = canonical
+		}
+	} else if !genericAccountTypes[strings.ToLower(tok.AccountType)] {
+		id.Issuer = tbl.Name(tok.AccountType)
+	}
+	if id.Account == "" && id.Issuer == "" {
+		id.Account = tok.Description()
+	}
+	return id
+}
+
+// App returns the Identity of an Authy App. Its issuer is the service that
+// its AssetsGroup belongs to, and its account is its name.
+func (tbl IssuerTable) App(app AuthenticatorApp) Identity {
+	id := Identity{Issuer: app.Name, Account: app.Name}
+	if app.AssetsGroup != "" {
+		id.Issuer = tbl.Name(app.AssetsGroup)
+	}
+	return id
+}
+
+// splitName splits a token name into its issuer and account, if it follows
+// one of the common conventions.
+func splitName(name string) Identity {
+	if i := strings.Index(name, ":"); i > 0 {
+		return Identity{
+			Issuer:  strings.TrimSpace(name[:i]),
+			Account: strings.TrimSpace(name[i+1:]),
+		}
+	}
+	if i := strings.LastIndex(name, "("); i > 0 && strings.HasSuffix(name, ")") {
+		return Identity{
+			Issuer:  strings.TrimSpace(name[:i]),
+			Account: strings.TrimSpace(name[i+1 : len(name)-1]),
+		}
+	}
+	// An email address (with a dot in its domain) is just an account
+	if i := strings.LastIndex(name, "@"); i > 0 && i < len(name)-1 && !strings.Contains(name[i+1:], ".") {
+		return Identity{
+			Issuer:  strings.TrimSpace(name[i+1:]),
+			Account: strings.TrimSpace(name[:i]),
+		}
+	}
+	return Identity{Account: name}
+}
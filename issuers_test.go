@@ -0,0 +1,126 @@
+package authy
+
+import "testing"
+
+func TestIssuerTableName(t *testing.T) {
+	tbl := IssuerTable{"github": "GitHub"}
+	tests := map[string]string{
+		"github":         "GitHub",
+		" GitHub ":       "GitHub",
+		"acme_corp":      "Acme Corp",
+		"acme-corp":      "Acme Corp",
+		"élan_vital":     "Élan Vital",
+		"öffentlich":     "Öffentlich",
+		"":               "",
+		"__":             "",
+		"über-dienst_2x": "Über Dienst 2x",
+	}
+	for id, expected := range tests {
+		if got := tbl.Name(id); got != expected {
+			t.Errorf("Name(%q) = %q, expected %q", id, got, expected)
+		}
+	}
+}
+
+func TestIssuerTableAccountType(t *testing.T) {
+	tbl := DefaultIssuers.Merge(IssuerTable{
+		"aws_console": "Amazon Web Services",
+		"zz_aws":      "Amazon Web Services",
+	})
+	// Several identifiers have the same name, so the first in sorted order
+	// must be chosen every time, whatever the order of the map
+	for i := 0; i < 50; i++ {
+		if got := tbl.AccountType("amazon web services"); got != "aws" {
+			t.Fatalf("Got account type %q, expected aws", got)
+		}
+	}
+	if got := tbl.AccountType(" GitHub "); got != "github" {
+		t.Errorf("Got account type %q, expected github", got)
+	}
+	if got := tbl.AccountType("Unknown Service"); got != "authenticator" {
+		t.Errorf("Got account type %q, expected authenticator", got)
+	}
+}
+
+func TestSplitName(t *testing.T) {
+	tests := map[string]Identity{
+		"GitHub: alice":         {Issuer: "GitHub", Account: "alice"},
+		" GitHub :alice@ex.com": {Issuer: "GitHub", Account: "alice@ex.com"},
+		"GitHub:":               {Issuer: "GitHub"},
+		":alice":                {Account: ":alice"},
+		"GitHub (alice)":        {Issuer: "GitHub", Account: "alice"},
+		"Acme (EU) (alice)":     {Issuer: "Acme (EU)", Account: "alice"},
+		"(alice)":               {Account: "(alice)"},
+		"GitHub (alice":         {Account: "GitHub (alice"},
+		"alice@github":          {Issuer: "github", Account: "alice"},
+		"alice@example.com":     {Account: "alice@example.com"},
+		"alice@":                {Account: "alice@"},
+		"Personal":              {Account: "Personal"},
+		"":                      {},
+	}
+	for name, expected := range tests {
+		if got := splitName(name); got != expected {
+			t.Errorf("splitName(%q) = %+v, expected %+v", name, got, expected)
+		}
+	}
+}
+
+func TestIssuerTableToken(t *testing.T) {
+	tbl := IssuerTable{"github": "GitHub", "acme_corp": "ACME Corporation"}
+	tests := []struct {
+		tok      AuthenticatorToken
+		expected Identity
+	}{
+		// The issuer in the name takes precedence, in its canonical spelling
+		{AuthenticatorToken{Name: "github: alice", AccountType: "acme_corp"}, Identity{"GitHub", "alice"}},
+		{AuthenticatorToken{Name: "Gitea (alice)", AccountType: "github"}, Identity{"Gitea", "alice"}},
+		{AuthenticatorToken{Name: "alice@github"}, Identity{"GitHub", "alice"}},
+		// The original name, before it was renamed, is preferred
+		{AuthenticatorToken{Name: "Work", OriginalName: "GitHub: alice"}, Identity{"GitHub", "alice"}},
+		// Otherwise the account type is looked up
+		{AuthenticatorToken{Name: "alice", AccountType: "acme_corp"}, Identity{"ACME Corporation", "alice"}},
+		{AuthenticatorToken{Name: "alice", AccountType: "initech_labs"}, Identity{"Initech Labs", "alice"}},
+		{AuthenticatorToken{Name: "alice@example.com", AccountType: "github"}, Identity{"GitHub", "alice@example.com"}},
+		// Unless it's generic
+		{AuthenticatorToken{Name: "alice", AccountType: "authenticator"}, Identity{"", "alice"}},
+		{AuthenticatorToken{Name: "alice", AccountType: "Generic"}, Identity{"", "alice"}},
+		// An unnamed token is described by its ID
+		{AuthenticatorToken{UniqueID: "1001", AccountType: "other"}, Identity{"", "Token-1001"}},
+		{AuthenticatorToken{UniqueID: "1001", AccountType: "github"}, Identity{"GitHub", ""}},
+	}
+	for _, tc := range tests {
+		if got := tbl.Token(tc.tok); got != tc.expected {
+			t.Errorf("Token(%+v) = %+v, expected %+v", tc.tok, got, tc.expected)
+		}
+	}
+}
+
+func TestIssuerTableApp(t *testing.T) {
+	tbl := IssuerTable{"twitch": "Twitch"}
+	tests := []struct {
+		app      AuthenticatorApp
+		expected Identity
+	}{
+		{AuthenticatorApp{Name: "Twitch", AssetsGroup: "twitch"}, Identity{"Twitch", "Twitch"}},
+		{AuthenticatorApp{Name: "My Site", AssetsGroup: "my_site"}, Identity{"My Site", "My Site"}},
+		{AuthenticatorApp{Name: "Sendgrid"}, Identity{"Sendgrid", "Sendgrid"}},
+	}
+	for _, tc := range tests {
+		if got := tbl.App(tc.app); got != tc.expected {
+			t.Errorf("App(%+v) = %+v, expected %+v", tc.app, got, tc.expected)
+		}
+	}
+}
+
+func TestIdentityLabel(t *testing.T) {
+	tests := map[Identity]string{
+		{"GitHub", "alice"}: "GitHub:alice",
+		{"GitHub", ""}:      "GitHub",
+		{"", "alice"}:       "alice",
+	}
+	for id, expected := range tests {
+		if got := id.Label(); got != expected {
+			t.Errorf("%+v.Label() = %q, expected %q", id, got, expected)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+// Package kdbx writes KeePass databases in the KDBX 4 format, which KeePassXC
+// and other KeePass clients can open.
+//
+// Databases are encrypted with AES-256 and a key derived by Argon2id. Secret
+// fields are additionally protected in memory by the inner ChaCha20 stream,
+// as KeePass expects.
+//
+//	db := kdbx.Database{Name: "Authy"}
+//	db.Entries = append(db.Entries, kdbx.Entry{
+//		Group: "GitHub",
+//		Title: "GitHub",
+//		OTP:   "otpauth://totp/GitHub:alice?secret=...",
+//	})
+//	err := db.Write(f, kdbx.Key{Password: []byte("hunter2")})
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+)
+
+// Entry is an entry in a database.
+type Entry struct {
+	// The name of the group that the entry is in, or empty for the root group
+	Group string
+
+	Title    string
+	UserName string
+	Password string
+	URL      string
+	Notes    string
+
+	// A Key URI (otpauth://) for the entry's TOTP, which is stored in the otp
+	// attribute that KeePassXC generates codes from
+	OTP string
+
+	Tags []string
+}
+
+// Database is a KeePass database, with its entries grouped by Entry.Group.
+type Database struct {
+	// The name of the database and its root group
+	Name string
+
+	Entries []Entry
+}
+
+// KDF parameters, a bit more than KeePassXC's defaults for Argon2id
+const (
+	argon2Iterations  = 10
+	argon2MemoryKiB   = 64 * 1024
+	argon2Parallelism = 2
+	argon2Version     = 0x13
+)
+
+var (
+	kdbxSignature1 = uint32(0x9AA2D903)
+	kdbxSignature2 = uint32(0xB54BFB67)
+	kdbxVersion4   = uint32(0x00040000)
+
+	cipherAES256 = []byte{0x31, 0xc1, 0xf2, 0xe6, 0xbf, 0x71, 0x43, 0x50, 0xbe, 0x58, 0x05, 0x21, 0x6a, 0xfc, 0x5a, 0xff}
+	kdfArgon2id  = []byte{0x9e, 0x29, 0x8b, 0x19, 0x56, 0xdb, 0x47, 0x73, 0xb2, 0x3d, 0xfc, 0x3e, 0xc6, 0xf0, 0xa1, 0xe6}
+)
+
+// Outer header field IDs
+const (
+	headerEnd         = 0
+	headerCipherID    = 2
+	headerCompression = 3
+	headerMasterSeed  = 4
+	headerIV          = 7
+	headerKDF         = 11
+)
+
+// Inner header field IDs
+const (
+	innerHeaderEnd       = 0
+	innerHeaderStreamID  = 1
+	innerHeaderStreamKey = 2
+
+	innerStreamChaCha20 = 3
+)
+
+// The size of blocks in the HMAC block stream
+const blockSize = 1024 * 1024
+
+// Write encrypts the database with key, and writes it to w in KDBX 4 format.
+func (db *Database) Write(w io.Writer, key Key) error {
+	composite, err := key.composite()
+	if err != nil {
+		return err
+	}
+
+	masterSeed, err := randomBytes(32)
+	if err != nil {
+		return err
+	}
+	iv, err := randomBytes(aes.BlockSize)
+	if err != nil {
+		return err
+	}
+	salt, err := randomBytes(32)
+	if err != nil {
+		return err
+	}
+	streamKey, err := randomBytes(64)
+	if err != nil {
+		return err
+	}
+
+	transformed := argon2.IDKey(composite, salt, argon2Iterations, argon2MemoryKiB, argon2Parallelism, 32)
+	encKey := sha256.Sum256(concat(masterSeed, transformed))
+	hmacKey := sha512.Sum512(concat(masterSeed, transformed, []byte{1}))
+
+	header := outerHeader(masterSeed, iv, salt)
+
+	// The payload is the inner header and the XML, compressed and encrypted
+	var payload bytes.Buffer
+	gz := gzip.NewWriter(&payload)
+	if _, err := gz.Write(innerHeader(streamKey)); err != nil {
+		return err
+	}
+	doc, err := db.marshalXML(streamKey)
+	if err != nil {
+		return err
+	}
+	if _, err := gz.Write(doc); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	ciphertext, err := encryptCBC(encKey[:], iv, payload.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	out.Write(header)
+	headerHash := sha256.Sum256(header)
+	out.Write(headerHash[:])
+	out.Write(blockHMAC(hmacKey[:], ^uint64(0), header))
+	writeBlocks(&out, hmacKey[:], ciphertext)
+
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+func outerHeader(masterSeed, iv, salt []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, kdbxSignature1)
+	binary.Write(&b, binary.LittleEndian, kdbxSignature2)
+	binary.Write(&b, binary.LittleEndian, kdbxVersion4)
+
+	compression := make([]byte, 4)
+	binary.LittleEndian.PutUint32(compression, 1) // gzip
+
+	kdf := variantDictionary{}
+	kdf.bytes("$UUID", kdfArgon2id)
+	kdf.bytes("S", salt)
+	kdf.uint32("P", argon2Parallelism)
+	kdf.uint64("M", argon2MemoryKiB*1024)
+	kdf.uint64("I", argon2Iterations)
+	kdf.uint32("V", argon2Version)
+
+	writeField(&b, headerCipherID, cipherAES256)
+	writeField(&b, headerCompression, compression)
+	writeField(&b, headerMasterSeed, masterSeed)
+	writeField(&b, headerIV, iv)
+	writeField(&b, headerKDF, kdf.encode())
+	writeField(&b, headerEnd, []byte("\r\n\r\n"))
+	return b.Bytes()
+}
+
+func innerHeader(streamKey []byte) []byte {
+	var b bytes.Buffer
+	streamID := make([]byte, 4)
+	binary.LittleEndian.PutUint32(streamID, innerStreamChaCha20)
+	writeField(&b, innerHeaderStreamID, streamID)
+	writeField(&b, innerHeaderStreamKey, streamKey)
+	writeField(&b, innerHeaderEnd, nil)
+	return b.Bytes()
+}
+
+func writeField(b *bytes.Buffer, id byte, data []byte) {
+	b.WriteByte(id)
+	binary.Write(b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+}
+
+// writeBlocks writes data as an HMAC block stream, which ends with an empty
+// block.
+func writeBlocks(b *bytes.Buffer, hmacKey, data []byte) {
+	for i := uint64(0); ; i++ {
+		n := len(data)
+		if n > blockSize {
+			n = blockSize
+		}
+		block := data[:n]
+		data = data[n:]
+
+		size := make([]byte, 4)
+		binary.LittleEndian.PutUint32(size, uint32(n))
+		b.Write(blockHMAC(hmacKey, i, concat(size, block)))
+		b.Write(size)
+		b.Write(block)
+		if n == 0 {
+			return
+		}
+	}
+}
+
+// blockHMAC authenticates a block of the HMAC block stream, including its
+// index. The header is authenticated as the block with the largest index.
+func blockHMAC(hmacKey []byte, index uint64, data []byte) []byte {
+	idx := make([]byte, 8)
+	binary.LittleEndian.PutUint64(idx, index)
+	blockKey := sha512.Sum512(concat(idx, hmacKey))
+
+	mac := hmac.New(sha256.New, blockKey[:])
+	if index != ^uint64(0) {
+		mac.Write(idx)
+	}
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func encryptCBC(key, iv, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	// PKCS#7 padding
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	buf := make([]byte, len(plaintext)+padding)
+	copy(buf, plaintext)
+	for i := len(plaintext); i < len(buf); i++ {
+		buf[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(buf, buf)
+	return buf, nil
+}
+
+// protector encrypts protected values with the inner random stream. Values
+// must be protected in the order they appear in the XML.
+type protector struct {
+	stream *chacha20.Cipher
+}
+
+func newProtector(streamKey []byte) (*protector, error) {
+	sum := sha512.Sum512(streamKey)
+	c, err := chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+	if err != nil {
+		return nil, err
+	}
+	return &protector{stream: c}, nil
+}
+
+func (p *protector) protect(s string) []byte {
+	buf := []byte(s)
+	p.stream.XORKeyStream(buf, buf)
+	return buf
+}
+
+// variantDictionary is KDBX's typed key-value encoding, used for the KDF
+// parameters.
+type variantDictionary struct {
+	b bytes.Buffer
+}
+
+func (d *variantDictionary) item(typ byte, key string, value []byte) {
+	d.b.WriteByte(typ)
+	binary.Write(&d.b, binary.LittleEndian, int32(len(key)))
+	d.b.WriteString(key)
+	binary.Write(&d.b, binary.LittleEndian, int32(len(value)))
+	d.b.Write(value)
+}
+
+func (d *variantDictionary) uint32(key string, v uint32) {
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, v)
+	d.item(0x04, key, buf)
+}
+
+func (d *variantDictionary) uint64(key string, v uint64) {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, v)
+	d.item(0x05, key, buf)
+}
+
+func (d *variantDictionary) bytes(key string, v []byte) {
+	d.item(0x42, key, v)
+}
+
+func (d *variantDictionary) encode() []byte {
+	out := []byte{0x00, 0x01} // version 1.0
+	out = append(out, d.b.Bytes()...)
+	return append(out, 0x00)
+}
+
+// kdbxTime encodes a time as KDBX 4 does, as the base64 of the seconds since
+// 0001-01-01.
+func kdbxTime(t time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.LittleEndian.PutUint64(buf, uint64(t.Unix()+62135596800))
+	return buf
+}
+
+func randomBytes(n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func joinTags(tags []string) string {
+	return strings.Join(tags, ";")
+}
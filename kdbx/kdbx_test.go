@@ -0,0 +1,368 @@
+package kdbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// readDatabase decrypts a KDBX 4 database as a KeePass client would, and
+// returns its XML with the protected values decrypted.
+func readDatabase(data []byte, key Key) (*xmlFile, error) {
+	r := bytes.NewReader(data)
+	var sig1, sig2, version uint32
+	binary.Read(r, binary.LittleEndian, &sig1)
+	binary.Read(r, binary.LittleEndian, &sig2)
+	binary.Read(r, binary.LittleEndian, &version)
+	if sig1 != kdbxSignature1 || sig2 != kdbxSignature2 || version != kdbxVersion4 {
+		return nil, errors.New("Not a KDBX 4 database")
+	}
+
+	fields, err := readFields(r)
+	if err != nil {
+		return nil, err
+	}
+	header := data[:len(data)-r.Len()]
+	if !bytes.Equal(fields[headerCipherID], cipherAES256) {
+		return nil, errors.New("Unexpected cipher")
+	}
+	kdf, err := readVariantDictionary(fields[headerKDF])
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(kdf["$UUID"], kdfArgon2id) {
+		return nil, errors.New("Unexpected KDF")
+	}
+
+	hash := make([]byte, 32)
+	headerMAC := make([]byte, 32)
+	io.ReadFull(r, hash)
+	io.ReadFull(r, headerMAC)
+	if sum := sha256.Sum256(header); !bytes.Equal(sum[:], hash) {
+		return nil, errors.New("The header hash doesn't match")
+	}
+
+	composite, err := key.composite()
+	if err != nil {
+		return nil, err
+	}
+	transformed := argon2.IDKey(composite, kdf["S"],
+		uint32(binary.LittleEndian.Uint64(kdf["I"])),
+		uint32(binary.LittleEndian.Uint64(kdf["M"])/1024),
+		uint8(binary.LittleEndian.Uint32(kdf["P"])), 32)
+	masterSeed := fields[headerMasterSeed]
+	encKey := sha256.Sum256(concat(masterSeed, transformed))
+	hmacKey := sha512.Sum512(concat(masterSeed, transformed, []byte{1}))
+	if !hmac.Equal(headerMAC, blockHMAC(hmacKey[:], ^uint64(0), header)) {
+		return nil, errors.New("The key is wrong, or the header is corrupt")
+	}
+
+	// Read the HMAC block stream
+	var ciphertext []byte
+	for i := uint64(0); ; i++ {
+		mac := make([]byte, 32)
+		sizeBuf := make([]byte, 4)
+		if _, err := io.ReadFull(r, mac); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, sizeBuf); err != nil {
+			return nil, err
+		}
+		block := make([]byte, binary.LittleEndian.Uint32(sizeBuf))
+		if _, err := io.ReadFull(r, block); err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(mac, blockHMAC(hmacKey[:], i, concat(sizeBuf, block))) {
+			return nil, fmt.Errorf("Block %d is corrupt", i)
+		}
+		if len(block) == 0 {
+			break
+		}
+		ciphertext = append(ciphertext, block...)
+	}
+
+	c, err := aes.NewCipher(encKey[:])
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("The payload isn't a whole number of blocks")
+	}
+	cipher.NewCBCDecrypter(c, fields[headerIV]).CryptBlocks(ciphertext, ciphertext)
+	padding := int(ciphertext[len(ciphertext)-1])
+	gz, err := gzip.NewReader(bytes.NewReader(ciphertext[:len(ciphertext)-padding]))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := ioutil.ReadAll(gz)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := bytes.NewReader(payload)
+	inner, err := readFields(pr)
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(inner[innerHeaderStreamID]) != innerStreamChaCha20 {
+		return nil, errors.New("Unexpected inner stream")
+	}
+	var doc xmlFile
+	if err := xml.NewDecoder(pr).Decode(&doc); err != nil {
+		return nil, err
+	}
+	p, err := newProtector(inner[innerHeaderStreamKey])
+	if err != nil {
+		return nil, err
+	}
+	if err := unprotect(&doc.Root.Group, p); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// readFields reads header fields up to the end field.
+func readFields(r *bytes.Reader) (map[byte][]byte, error) {
+	fields := map[byte][]byte{}
+	for {
+		id, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		if id == headerEnd {
+			return fields, nil
+		}
+		fields[id] = data
+	}
+}
+
+func readVariantDictionary(data []byte) (map[string][]byte, error) {
+	if len(data) < 2 || data[1] != 0x01 {
+		return nil, errors.New("Unexpected variant dictionary version")
+	}
+	r := bytes.NewReader(data[2:])
+	items := map[string][]byte{}
+	for {
+		typ, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if typ == 0 {
+			return items, nil
+		}
+		var n int32
+		binary.Read(r, binary.LittleEndian, &n)
+		k := make([]byte, n)
+		io.ReadFull(r, k)
+		binary.Read(r, binary.LittleEndian, &n)
+		v := make([]byte, n)
+		if _, err := io.ReadFull(r, v); err != nil {
+			return nil, err
+		}
+		items[string(k)] = v
+	}
+}
+
+// unprotect decrypts protected values in document order, like KeePass.
+func unprotect(g *xmlGroup, p *protector) error {
+	for i := range g.Entries {
+		for j := range g.Entries[i].Strings {
+			v := &g.Entries[i].Strings[j].Value
+			if v.Protected != "True" {
+				continue
+			}
+			buf, err := base64.StdEncoding.DecodeString(v.Value)
+			if err != nil {
+				return err
+			}
+			v.Value = string(p.protect(string(buf)))
+		}
+	}
+	for i := range g.Groups {
+		if err := unprotect(&g.Groups[i], p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryStrings returns the strings of the entries of g and its subgroups,
+// by title.
+func entryStrings(g xmlGroup, out map[string]map[string]xmlValue) {
+	for _, e := range g.Entries {
+		vals := map[string]xmlValue{}
+		for _, s := range e.Strings {
+			vals[s.Key] = s.Value
+		}
+		out[vals["Title"].Value] = vals
+	}
+	for _, sub := range g.Groups {
+		entryStrings(sub, out)
+	}
+}
+
+// An XML key file, in the version 2.0 format that KeePassXC generates.
+const testKeyFile = `<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta>
+		<Version>2.0</Version>
+	</Meta>
+	<Key>
+		<Data Hash="C221B72A">
+			A57D0EC5 6C0A4D9A 8C4E4D7A 3E0A6B6F
+			0B5C9D3E 2F1A8B7C 6D5E4F3A 2B1C0D9E
+		</Data>
+	</Key>
+</KeyFile>
+`
+
+func TestWriteRoundTrip(t *testing.T) {
+	db := Database{Name: "Authy", Entries: []Entry{
+		{Group: "GitHub", Title: "GitHub", UserName: "alice", OTP: "otpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP&issuer=GitHub"},
+		{Group: "Google", Title: "Google", UserName: "bob@example.com", Password: "hunter2",
+			OTP: "otpauth://totp/Google:bob%40example.com?secret=GEZDGNBVGY3TQOJQ&digits=8&issuer=Google", Tags: []string{"work", "mail"}},
+		{Title: "Slack", OTP: "otpauth://totp/Slack?secret=KRUGKIDROVUWG2ZA"},
+	}}
+	key := Key{Password: []byte("correct horse"), KeyFile: []byte(testKeyFile)}
+
+	var buf bytes.Buffer
+	if err := db.Write(&buf, key); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := readDatabase(buf.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Meta.DatabaseName != "Authy" || doc.Root.Group.Name != "Authy" {
+		t.Errorf("Unexpected database name %q, root group %q", doc.Meta.DatabaseName, doc.Root.Group.Name)
+	}
+
+	got := map[string]map[string]xmlValue{}
+	entryStrings(doc.Root.Group, got)
+	for _, e := range db.Entries {
+		vals, ok := got[e.Title]
+		if !ok {
+			t.Errorf("Entry %s is missing", e.Title)
+			continue
+		}
+		if otp := vals["otp"]; otp.Value != e.OTP || otp.Protected != "True" {
+			t.Errorf("%s: got otp %+v, expected protected %q", e.Title, otp, e.OTP)
+		}
+		if pw := vals["Password"]; pw.Value != e.Password || pw.Protected != "True" {
+			t.Errorf("%s: got password %+v, expected protected %q", e.Title, pw, e.Password)
+		}
+		if vals["UserName"].Value != e.UserName {
+			t.Errorf("%s: got user name %q, expected %q", e.Title, vals["UserName"].Value, e.UserName)
+		}
+	}
+
+	// Both parts of the key are needed
+	for _, wrong := range []Key{
+		{Password: key.Password},
+		{KeyFile: key.KeyFile},
+		{Password: []byte("wrong"), KeyFile: key.KeyFile},
+	} {
+		if _, err := readDatabase(buf.Bytes(), wrong); err == nil {
+			t.Errorf("The database was opened with %+v", wrong)
+		}
+	}
+}
+
+// testdata/independent.kdbx was written by a separate KDBX 4 implementation,
+// using libsodium for Argon2id and ChaCha20 and OpenSSL for AES, to check that
+// this package's key derivation, block stream and inner stream agree with it.
+// It is protected by "correct horse" and testKeyFile.
+func TestReadIndependentDatabase(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/independent.kdbx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := Key{Password: []byte("correct horse"), KeyFile: []byte(testKeyFile)}
+	doc, err := readDatabase(data, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Meta.DatabaseName != "Fixture" || doc.Root.Group.Name != "Fixture" || len(doc.Root.Group.Groups) != 2 {
+		t.Errorf("Unexpected database %q, root group %+v", doc.Meta.DatabaseName, doc.Root.Group)
+	}
+
+	got := map[string]map[string]xmlValue{}
+	entryStrings(doc.Root.Group, got)
+	expected := map[string]map[string]string{
+		"GitHub": {"UserName": "alice", "Password": "", "otp": "otpauth://totp/GitHub:alice?secret=JBSWY3DPEHPK3PXP&issuer=GitHub"},
+		"Google": {"UserName": "bob@example.com", "Password": "hunter2",
+			"otp": "otpauth://totp/Google:bob%40example.com?secret=GEZDGNBVGY3TQOJQ&digits=8&issuer=Google"},
+		"Slack": {"UserName": "", "Password": "", "otp": "otpauth://totp/Slack?secret=KRUGKIDROVUWG2ZA"},
+	}
+	for title, fields := range expected {
+		for k, v := range fields {
+			if got[title][k].Value != v {
+				t.Errorf("%s: got %s %q, expected %q", title, k, got[title][k].Value, v)
+			}
+		}
+	}
+	if tags := doc.Root.Group.Groups[1].Entries[0].Tags; tags != joinTags([]string{"work", "mail"}) {
+		t.Errorf("Got the tags %q", tags)
+	}
+
+	for _, wrong := range []Key{{Password: key.Password}, {Password: []byte("wrong"), KeyFile: key.KeyFile}} {
+		if _, err := readDatabase(data, wrong); err == nil {
+			t.Errorf("The database was opened with %+v", wrong)
+		}
+	}
+}
+
+func TestKeyFileHash(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xab}, 32)
+	sum := sha256.Sum256([]byte("not a key file format"))
+	tests := []struct {
+		name     string
+		file     string
+		expected []byte
+	}{
+		{"32 bytes", string(raw), raw},
+		{"64 hex digits", fmt.Sprintf("%x", raw), raw},
+		{"XML 1.0", "<KeyFile><Meta><Version>1.00</Version></Meta><Key><Data>" +
+			base64.StdEncoding.EncodeToString(raw) + "</Data></Key></KeyFile>", raw},
+		{"XML 2.0", testKeyFile, []byte{
+			0xa5, 0x7d, 0x0e, 0xc5, 0x6c, 0x0a, 0x4d, 0x9a, 0x8c, 0x4e, 0x4d, 0x7a, 0x3e, 0x0a, 0x6b, 0x6f,
+			0x0b, 0x5c, 0x9d, 0x3e, 0x2f, 0x1a, 0x8b, 0x7c, 0x6d, 0x5e, 0x4f, 0x3a, 0x2b, 0x1c, 0x0d, 0x9e,
+		}},
+		{"other", "not a key file format", sum[:]},
+	}
+	for _, tt := range tests {
+		got, err := keyFileHash([]byte(tt.file))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !bytes.Equal(got, tt.expected) {
+			t.Errorf("%s: got %x, expected %x", tt.name, got, tt.expected)
+		}
+	}
+
+	corrupt := bytes.Replace([]byte(testKeyFile), []byte("A57D0EC5"), []byte("A57D0EC6"), 1)
+	if _, err := keyFileHash(corrupt); err == nil {
+		t.Error("A key file whose hash doesn't match was accepted")
+	}
+}
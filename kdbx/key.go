@@ -0,0 +1,99 @@
+package kdbx
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Key is the composite key which protects a database: a password, a key
+// file, or both.
+type Key struct {
+	Password []byte
+
+	// The contents of a KeePass key file, nil if none is used
+	KeyFile []byte
+}
+
+// composite returns the composite key, which is the SHA-256 of the hashes of
+// each of its components.
+func (k Key) composite() ([]byte, error) {
+	if k.Password == nil && k.KeyFile == nil {
+		return nil, errors.New("A password or key file is required")
+	}
+	h := sha256.New()
+	if k.Password != nil {
+		sum := sha256.Sum256(k.Password)
+		h.Write(sum[:])
+	}
+	if k.KeyFile != nil {
+		fileKey, err := keyFileHash(k.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		h.Write(fileKey)
+	}
+	return h.Sum(nil), nil
+}
+
+// keyFile is the XML key file format, versions 1.0 and 2.0.
+type keyFile struct {
+	XMLName xml.Name `xml:"KeyFile"`
+	Version string   `xml:"Meta>Version"`
+	Data    struct {
+		Hash  string `xml:"Hash,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Key>Data"`
+}
+
+// keyFileHash returns the 32 byte key of a key file. Like KeePass, it accepts
+// XML key files, files of exactly 32 bytes or 64 hex digits, and otherwise
+// hashes the whole file.
+func keyFileHash(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<?xml")) ||
+		bytes.HasPrefix(bytes.TrimSpace(data), []byte("<KeyFile")) {
+		return xmlKeyFileHash(data)
+	}
+	if len(data) == 32 {
+		return data, nil
+	}
+	if len(data) == 64 {
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
+
+func xmlKeyFileHash(data []byte) ([]byte, error) {
+	var kf keyFile
+	if err := xml.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("Failed to parse the key file: %v", err)
+	}
+	value := strings.Join(strings.Fields(kf.Data.Value), "")
+	switch kf.Version {
+	case "1.0", "1.00":
+		return base64.StdEncoding.DecodeString(value)
+	case "2.0":
+		key, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode the key file: %v", err)
+		}
+		// The hash attribute is the start of the SHA-256 of the key
+		if kf.Data.Hash != "" {
+			sum := sha256.Sum256(key)
+			if !strings.EqualFold(hex.EncodeToString(sum[:4]), kf.Data.Hash) {
+				return nil, errors.New("The key file is corrupt: its hash doesn't match")
+			}
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("Unsupported key file version %q", kf.Version)
+	}
+}
@@ -0,0 +1,202 @@
+package kdbx
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"time"
+)
+
+type xmlFile struct {
+	XMLName xml.Name `xml:"KeePassFile"`
+	Meta    xmlMeta  `xml:"Meta"`
+	Root    xmlRoot  `xml:"Root"`
+}
+
+type xmlMeta struct {
+	Generator           string              `xml:"Generator"`
+	DatabaseName        string              `xml:"DatabaseName"`
+	DatabaseNameChanged string              `xml:"DatabaseNameChanged"`
+	MemoryProtection    xmlMemoryProtection `xml:"MemoryProtection"`
+	RecycleBinEnabled   string              `xml:"RecycleBinEnabled"`
+	HistoryMaxItems     int                 `xml:"HistoryMaxItems"`
+	HistoryMaxSize      int                 `xml:"HistoryMaxSize"`
+}
+
+type xmlMemoryProtection struct {
+	ProtectTitle    string `xml:"ProtectTitle"`
+	ProtectUserName string `xml:"ProtectUserName"`
+	ProtectPassword string `xml:"ProtectPassword"`
+	ProtectURL      string `xml:"ProtectURL"`
+	ProtectNotes    string `xml:"ProtectNotes"`
+}
+
+type xmlRoot struct {
+	Group          xmlGroup `xml:"Group"`
+	DeletedObjects struct{} `xml:"DeletedObjects"`
+}
+
+type xmlGroup struct {
+	UUID       string     `xml:"UUID"`
+	Name       string     `xml:"Name"`
+	Times      xmlTimes   `xml:"Times"`
+	IsExpanded string     `xml:"IsExpanded"`
+	Entries    []xmlEntry `xml:"Entry"`
+	Groups     []xmlGroup `xml:"Group"`
+}
+
+type xmlEntry struct {
+	UUID    string      `xml:"UUID"`
+	Tags    string      `xml:"Tags,omitempty"`
+	Times   xmlTimes    `xml:"Times"`
+	Strings []xmlString `xml:"String"`
+}
+
+type xmlString struct {
+	Key   string   `xml:"Key"`
+	Value xmlValue `xml:"Value"`
+}
+
+type xmlValue struct {
+	Protected string `xml:"Protected,attr,omitempty"`
+	Value     string `xml:",chardata"`
+}
+
+type xmlTimes struct {
+	CreationTime         string `xml:"CreationTime"`
+	LastModificationTime string `xml:"LastModificationTime"`
+	LastAccessTime       string `xml:"LastAccessTime"`
+	ExpiryTime           string `xml:"ExpiryTime"`
+	Expires              string `xml:"Expires"`
+	UsageCount           int    `xml:"UsageCount"`
+	LocationChanged      string `xml:"LocationChanged"`
+}
+
+// marshalXML encodes the database as the KeePass XML document, with the
+// protected values encrypted by the inner stream with streamKey.
+func (db *Database) marshalXML(streamKey []byte) ([]byte, error) {
+	p, err := newProtector(streamKey)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	times := newTimes(now)
+
+	newGroup := func(name string) (xmlGroup, error) {
+		uuid, err := newUUID()
+		return xmlGroup{UUID: uuid, Name: name, Times: times, IsExpanded: "True"}, err
+	}
+
+	root, err := newGroup(db.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are grouped in the order that their groups first appear.
+	// Protected values must be encrypted in document order, in which a
+	// group's entries come before its subgroups.
+	var groupOrder []string
+	grouped := map[string][]Entry{}
+	for _, e := range db.Entries {
+		if e.Group == "" {
+			continue
+		}
+		if _, ok := grouped[e.Group]; !ok {
+			groupOrder = append(groupOrder, e.Group)
+		}
+		grouped[e.Group] = append(grouped[e.Group], e)
+	}
+	for _, e := range db.Entries {
+		if e.Group != "" {
+			continue
+		}
+		xe, err := e.toXML(p, times)
+		if err != nil {
+			return nil, err
+		}
+		root.Entries = append(root.Entries, xe)
+	}
+	for _, name := range groupOrder {
+		g, err := newGroup(name)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range grouped[name] {
+			xe, err := e.toXML(p, times)
+			if err != nil {
+				return nil, err
+			}
+			g.Entries = append(g.Entries, xe)
+		}
+		root.Groups = append(root.Groups, g)
+	}
+
+	doc := xmlFile{
+		Meta: xmlMeta{
+			Generator:           "authy-export",
+			DatabaseName:        db.Name,
+			DatabaseNameChanged: times.CreationTime,
+			MemoryProtection: xmlMemoryProtection{
+				ProtectTitle:    "False",
+				ProtectUserName: "False",
+				ProtectPassword: "True",
+				ProtectURL:      "False",
+				ProtectNotes:    "False",
+			},
+			RecycleBinEnabled: "True",
+			HistoryMaxItems:   10,
+			HistoryMaxSize:    6291456,
+		},
+		Root: xmlRoot{Group: root},
+	}
+	out, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func (e Entry) toXML(p *protector, times xmlTimes) (xmlEntry, error) {
+	uuid, err := newUUID()
+	if err != nil {
+		return xmlEntry{}, err
+	}
+	xe := xmlEntry{UUID: uuid, Tags: joinTags(e.Tags), Times: times}
+	plain := func(key, value string) {
+		xe.Strings = append(xe.Strings, xmlString{Key: key, Value: xmlValue{Value: value}})
+	}
+	protected := func(key, value string) {
+		xe.Strings = append(xe.Strings, xmlString{Key: key, Value: xmlValue{
+			Protected: "True",
+			Value:     base64.StdEncoding.EncodeToString(p.protect(value)),
+		}})
+	}
+	plain("Title", e.Title)
+	plain("UserName", e.UserName)
+	protected("Password", e.Password)
+	plain("URL", e.URL)
+	plain("Notes", e.Notes)
+	if e.OTP != "" {
+		protected("otp", e.OTP)
+	}
+	return xe, nil
+}
+
+func newTimes(t time.Time) xmlTimes {
+	ts := base64.StdEncoding.EncodeToString(kdbxTime(t))
+	return xmlTimes{
+		CreationTime:         ts,
+		LastModificationTime: ts,
+		LastAccessTime:       ts,
+		ExpiryTime:           ts,
+		Expires:              "False",
+		LocationChanged:      ts,
+	}
+}
+
+func newUUID() (string, error) {
+	buf, err := randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
@@ -1,14 +1,13 @@
 package authy
 
 import (
+	"crypto/aes"
 	"crypto/rsa"
-	"crypto/x509"
 	"encoding/base32"
 	"encoding/hex"
-	"encoding/pem"
 	"errors"
-	"fmt"
 	"strings"
+	"time"
 )
 
 // ViaMethod represents the methods available for new device registration
@@ -114,17 +113,12 @@ type DevicePrivateKeyResponse struct {
 	Success    bool   `json:"success"`
 }
 
-// AsPrivateKey parses the PEM private key in PrivateKey
+// AsPrivateKey parses the private key in PrivateKey. See ParsePrivateKey.
 func (r DevicePrivateKeyResponse) AsPrivateKey() (*rsa.PrivateKey, error) {
 	if !r.Success || r.PrivateKey == "" {
 		return nil, errors.New("This response does not contain a device private key")
 	}
-	blk, _ := pem.Decode([]byte(r.PrivateKey))
-	pk, err := x509.ParsePKCS1PrivateKey(blk.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("Couldn't parse private key: %v", err)
-	}
-	return pk, nil
+	return ParsePrivateKey(r.PrivateKey)
 }
 
 // AuthenticatorTokensResponse is the response from:
@@ -169,6 +163,10 @@ type AuthenticatorToken struct {
 	// The salt used to encrypt the EncryptedSeed
 	Salt string `json:"salt"`
 
+	// The IV used to encrypt the EncryptedSeed (hex-encoded). Older tokens
+	// don't have one, and are encrypted with an all-zero IV.
+	UniqueIV string `json:"unique_iv,omitempty"`
+
 	// The ID of this token
 	UniqueID string `json:"unique_id"`
 }
@@ -176,7 +174,7 @@ type AuthenticatorToken struct {
 // Decrypt returns the base32-encoded seed for this TOTP token, decrypted
 // by passphrase.
 func (t AuthenticatorToken) Decrypt(passphrase string) (string, error) {
-	secret, err := decryptToken(t.KDFRounds, t.EncryptedSeed, t.Salt, passphrase)
+	secret, err := decryptToken(t.KDFRounds, t.EncryptedSeed, t.Salt, t.UniqueIV, passphrase)
 	if err != nil {
 		return "", err
 	}
@@ -184,9 +182,53 @@ func (t AuthenticatorToken) Decrypt(passphrase string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	// A wrong passphrase leaves valid padding once in a while, so a seed
+	// which isn't printable text is taken to be a decryption failure too
+	for _, c := range buf {
+		if c < 0x20 || c > 0x7e {
+			return "", errors.New("decryption failed")
+		}
+	}
 	return strings.ToUpper(string(buf)), nil
 }
 
+// Encrypt sets EncryptedSeed to the base32-encoded seed, encrypted by
+// passphrase with a fresh Salt and UniqueIV. The key is derived with
+// KDFRounds rounds, which is set to DefaultKDFRounds if zero.
+func (t *AuthenticatorToken) Encrypt(seed, passphrase string) error {
+	// The apps store the seed as unpadded lowercase base32
+	canonical, err := NormalizeSecret(seed)
+	if err != nil {
+		return err
+	}
+	return t.encryptSeed(strings.ToLower(canonical), passphrase)
+}
+
+// encryptSeed encrypts seed as it is, without validating it, so that
+// legacy tokens with seeds that Encrypt rejects can be re-encrypted.
+func (t *AuthenticatorToken) encryptSeed(seed, passphrase string) error {
+	salt, err := randomBytes(16)
+	if err != nil {
+		return err
+	}
+	iv, err := randomBytes(aes.BlockSize)
+	if err != nil {
+		return err
+	}
+	if t.KDFRounds == 0 {
+		t.KDFRounds = DefaultKDFRounds
+	}
+
+	encrypted, err := encryptToken(t.KDFRounds, []byte(seed), hex.EncodeToString(salt), hex.EncodeToString(iv), passphrase)
+	if err != nil {
+		return err
+	}
+	t.EncryptedSeed = encrypted
+	t.Salt = hex.EncodeToString(salt)
+	t.UniqueIV = hex.EncodeToString(iv)
+	return nil
+}
+
 // Description returns OriginalName if not empty, otherwise Name,
 // otherwise `Token-{UniqueID}`.
 func (t AuthenticatorToken) Description() string {
@@ -217,17 +259,24 @@ type AuthenticatorAppsResponse struct {
 
 // AuthenticatorApp is embedded in AuthenticatorAppsResponse
 type AuthenticatorApp struct {
+	// The ID of this app
 	ID string `json:"_id"`
 
 	// Display name of the token
 	Name string `json:"name"`
 
+	// Presumably the ID of the service (the Twilio Authy application)
+	// which this app belongs to
 	SerialID int `json:"serial_id"`
 
+	// Purpose not known
 	Version int `json:"version"`
 
+	// Identifies the logo and colours the Authy app uses for this app,
+	// which is usually named after the service. See Issuer.
 	AssetsGroup string `json:"assets_group"`
 
+	// Purpose not known, but presumably the Authy User ID
 	AuthyID uint64 `json:"authy_id"`
 
 	// The Device Secret Seed (hex-encoded). It is the TOTP
@@ -248,3 +297,90 @@ func (a AuthenticatorApp) Token() (string, error) {
 	encoder := base32.StdEncoding.WithPadding(base32.NoPadding)
 	return encoder.EncodeToString(decoded), nil
 }
+
+// SuccessResponse is the response from endpoints which only report
+// whether the request succeeded.
+type SuccessResponse struct {
+	// Display to user
+	Message string `json:"message"`
+
+	// Whether this request succeeded
+	Success bool `json:"success"`
+}
+
+// ApprovalRequestsResponse is the response from:
+// https://api.authy.com/json/users/{User_ID}/devices/{Device_ID}/approval_requests?api_key={API_Key}&otp1={OTP_1}&otp2={OTP_2}&otp3={OTP_3}&device_id={Device_ID}
+type ApprovalRequestsResponse struct {
+	// Display to user
+	Message string `json:"message"`
+
+	// The push authentication requests for the device
+	ApprovalRequests []ApprovalRequest `json:"approval_requests"`
+
+	// Whether this request succeeded
+	Success bool `json:"success"`
+}
+
+// ApprovalRequest is a push authentication (OneTouch) request, which a
+// service has sent for the user to approve or deny from one of their
+// devices. It is embedded in ApprovalRequestsResponse.
+type ApprovalRequest struct {
+	// The ID of this approval request
+	UUID string `json:"uuid"`
+
+	// pending, approved, denied or expired
+	Status string `json:"status"`
+
+	// The name of the service which sent the request
+	AppName string `json:"app_name"`
+
+	// Display to user, e.g. "Login requested"
+	Message string `json:"message"`
+
+	// Details for the user to check before responding, keyed by their
+	// display name. The service chooses these, but they commonly include
+	// the location and IP address that the request originated from.
+	Details map[string]string `json:"details"`
+
+	// When the request was created (unix seconds)
+	CreatedAt int64 `json:"created_at"`
+
+	// When the request expires (unix seconds)
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// IsPending reports whether the request is still awaiting a response at
+// time t.
+func (r ApprovalRequest) IsPending(t time.Time) bool {
+	return r.Status == "pending" && (r.ExpiresAt == 0 || t.Unix() < r.ExpiresAt)
+}
+
+// Location returns the location the request originated from, if the
+// service included it in the details.
+func (r ApprovalRequest) Location() string {
+	for k, v := range r.Details {
+		if strings.EqualFold(k, "location") {
+			return v
+		}
+	}
+	return ""
+}
+
+// AuthenticatorTokenResponse is the response from:
+// https://api.authy.com/json/users/{User_ID}/authenticator_tokens (POST)
+type AuthenticatorTokenResponse struct {
+	// Display to user
+	Message string `json:"message"`
+
+	// The token as stored by Authy
+	AuthenticatorToken AuthenticatorToken `json:"authenticator_token"`
+
+	// Whether this request succeeded
+	Success bool `json:"success"`
+}
+
+// Issuer returns the name of the service this app belongs to, based on its
+// AssetsGroup, or its Name if there isn't one.
+func (a AuthenticatorApp) Issuer() string {
+	return DefaultIssuers.App(a).Issuer
+}
@@ -0,0 +1,227 @@
+// Package otpauth parses and formats one-time password keys in the Key URI
+// format (otpauth://), which is the common format that the importers of
+// other authenticator apps' backups produce.
+//
+// See https://github.com/google/google-authenticator/wiki/Key-Uri-Format.
+package otpauth
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrPasswordRequired is returned by importers when a backup is encrypted,
+// but no password was given.
+var ErrPasswordRequired = errors.New("The backup is encrypted, and needs a password")
+
+// UnsupportedError is returned by importers, along with the keys that they
+// could read, when some entries of a backup are of kinds which aren't
+// supported, and were left out. Parse returns it for a URI of an unsupported
+// type.
+type UnsupportedError struct {
+	// Descriptions of the entries which were left out
+	Skipped []string
+}
+
+func (e *UnsupportedError) Error() string {
+	if len(e.Skipped) == 1 {
+		return e.Skipped[0] + " isn't supported"
+	}
+	return fmt.Sprintf("%d entries aren't supported: %s", len(e.Skipped), strings.Join(e.Skipped, "; "))
+}
+
+// Types of keys
+const (
+	TypeTOTP  = "totp"
+	TypeHOTP  = "hotp"
+	TypeSteam = "steam"
+)
+
+// Key is a one-time password key.
+type Key struct {
+	// TypeTOTP, TypeHOTP or TypeSteam
+	Type string
+
+	Issuer  string
+	Account string
+
+	// The base32-encoded secret, uppercase and without padding
+	Secret string
+
+	// SHA1, SHA256 or SHA512
+	Algorithm string
+
+	Digits int
+
+	// The period of TOTP keys, in seconds
+	Period int
+
+	// The counter of HOTP keys
+	Counter uint64
+
+	// Groups or tags that the key was in
+	Tags []string
+}
+
+// New returns a TOTP key with the default parameters: SHA1, 6 digits and a
+// period of 30 seconds.
+func New(issuer, account, secret string) Key {
+	return Key{
+		Type:      TypeTOTP,
+		Issuer:    issuer,
+		Account:   account,
+		Secret:    cleanSecret(secret),
+		Algorithm: "SHA1",
+		Digits:    6,
+		Period:    30,
+	}
+}
+
+// Label returns the label of the key, "Issuer:Account".
+func (k Key) Label() string {
+	if k.Issuer == "" {
+		return k.Account
+	}
+	if k.Account == "" {
+		return k.Issuer
+	}
+	return k.Issuer + ":" + k.Account
+}
+
+// URI returns the key in Key URI format.
+func (k Key) URI() string {
+	params := url.Values{}
+	params.Set("secret", k.Secret)
+	if k.Issuer != "" {
+		params.Set("issuer", k.Issuer)
+	}
+	if k.Algorithm != "" && k.Algorithm != "SHA1" {
+		params.Set("algorithm", k.Algorithm)
+	}
+	if k.Digits != 0 {
+		params.Set("digits", strconv.Itoa(k.Digits))
+	}
+	switch k.Type {
+	case TypeHOTP:
+		params.Set("counter", strconv.FormatUint(k.Counter, 10))
+	default:
+		if k.Period != 0 && k.Period != 30 {
+			params.Set("period", strconv.Itoa(k.Period))
+		}
+	}
+	typ := k.Type
+	if typ == "" {
+		typ = TypeTOTP
+	}
+	// Query encoding turns spaces into "+", which some apps show literally
+	// in the issuer, so they are percent-encoded like those of the label
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     typ,
+		Path:     k.Label(),
+		RawQuery: strings.Replace(params.Encode(), "+", "%20", -1),
+	}
+	return u.String()
+}
+
+// Parse parses a Key URI.
+func Parse(uri string) (Key, error) {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return Key{}, err
+	}
+	if u.Scheme != "otpauth" {
+		return Key{}, fmt.Errorf("Not an otpauth URI: %s", u.Scheme)
+	}
+
+	k := New("", "", "")
+	label := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(label, ":"); i >= 0 {
+		k.Issuer = strings.TrimSpace(label[:i])
+		k.Account = strings.TrimSpace(label[i+1:])
+	} else {
+		k.Account = strings.TrimSpace(label)
+	}
+
+	k.Type = strings.ToLower(u.Host)
+	switch k.Type {
+	case TypeTOTP, TypeHOTP, TypeSteam:
+	default:
+		return Key{}, &UnsupportedError{Skipped: []string{fmt.Sprintf("%s (%s key)", label, u.Host)}}
+	}
+
+	q := u.Query()
+	if issuer := q.Get("issuer"); issuer != "" {
+		k.Issuer = issuer
+	}
+	k.Secret = cleanSecret(q.Get("secret"))
+	if k.Secret == "" {
+		return Key{}, errors.New("The URI has no secret")
+	}
+	if alg := q.Get("algorithm"); alg != "" {
+		k.Algorithm = strings.ToUpper(alg)
+	}
+	if k.Type == TypeSteam || q.Get("encoder") == "steam" {
+		k.Type = TypeSteam
+		k.Digits = 5
+	}
+	if v := q.Get("digits"); v != "" {
+		if k.Digits, err = strconv.Atoi(v); err != nil {
+			return Key{}, fmt.Errorf("Invalid digits %q", v)
+		}
+	}
+	if v := q.Get("period"); v != "" {
+		if k.Period, err = strconv.Atoi(v); err != nil || k.Period <= 0 {
+			return Key{}, fmt.Errorf("Invalid period %q", v)
+		}
+	}
+	if v := q.Get("counter"); v != "" {
+		if k.Counter, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return Key{}, fmt.Errorf("Invalid counter %q", v)
+		}
+	}
+	return k, nil
+}
+
+// ReadURIs reads a list of Key URIs, one per line. Blank lines and lines
+// starting with # are skipped, and URIs of unsupported types are left out
+// and reported with an UnsupportedError.
+func ReadURIs(r io.Reader) ([]Key, error) {
+	var keys []Key
+	var skipped []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, err := Parse(line)
+		if uerr, ok := err.(*UnsupportedError); ok {
+			skipped = append(skipped, uerr.Skipped...)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", n, err)
+		}
+		keys = append(keys, k)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(skipped) > 0 {
+		return keys, &UnsupportedError{Skipped: skipped}
+	}
+	return keys, nil
+}
+
+// cleanSecret uppercases a base32 secret, and removes spaces and padding.
+func cleanSecret(s string) string {
+	s = strings.Join(strings.Fields(s), "")
+	return strings.ToUpper(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,77 @@
+package otpauth
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestURIEncodesSpaces(t *testing.T) {
+	k := New("Amazon Web Services", "alice smith", "JBSWY3DPEHPK3PXP")
+	uri := k.URI()
+	expected := "otpauth://totp/Amazon%20Web%20Services:alice%20smith?digits=6&issuer=Amazon%20Web%20Services&secret=JBSWY3DPEHPK3PXP"
+	if uri != expected {
+		t.Errorf("Got %s, expected %s", uri, expected)
+	}
+	if strings.Contains(uri, "+") {
+		t.Errorf("Spaces were encoded as +: %s", uri)
+	}
+
+	parsed, err := Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Issuer != k.Issuer || parsed.Account != k.Account || parsed.Secret != k.Secret {
+		t.Errorf("Parsed %+v, expected %+v", parsed, k)
+	}
+}
+
+func TestURIKeepsPlus(t *testing.T) {
+	k := New("C++ Forum", "a+b@example.com", "JBSWY3DPEHPK3PXP")
+	parsed, err := Parse(k.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Issuer != k.Issuer || parsed.Account != k.Account {
+		t.Errorf("Parsed %+v from %s, expected %+v", parsed, k.URI(), k)
+	}
+}
+
+func TestReadURIs(t *testing.T) {
+	f, err := os.Open("testdata/uris.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	keys, err := ReadURIs(f)
+
+	// The Yandex key is left out and reported, and the rest are read
+	uerr, ok := err.(*UnsupportedError)
+	if !ok || len(uerr.Skipped) != 1 || !strings.Contains(uerr.Skipped[0], "Yandex:dave") {
+		t.Errorf("Expected the Yandex key to be skipped, got %v", err)
+	}
+	expected := []string{
+		"otpauth://totp/GitHub:alice?digits=6&issuer=GitHub&secret=JBSWY3DPEHPK3PXP",
+		"otpauth://hotp/Google:bob@example.com?counter=7&digits=6&issuer=Google&secret=GEZDGNBVGY3TQOJQ",
+		"otpauth://steam/Steam:carol?digits=5&issuer=Steam&secret=KRUGKIDROVUWG2ZA",
+		"otpauth://totp/Amazon%20Web%20Services:erin?algorithm=SHA256&digits=8&issuer=Amazon%20Web%20Services&period=60&secret=ONSWG4TFOQQGC4TF",
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Got %d keys, expected %d", len(keys), len(expected))
+	}
+	for i, k := range keys {
+		if k.URI() != expected[i] {
+			t.Errorf("Key %d: got %s, expected %s", i, k.URI(), expected[i])
+		}
+	}
+}
+
+func TestReadURIsRejectsMalformed(t *testing.T) {
+	_, err := ReadURIs(strings.NewReader("otpauth://totp/GitHub:alice?issuer=GitHub\n"))
+	if err == nil || !strings.Contains(err.Error(), "Line 1") {
+		t.Errorf("Expected an error for line 1, got %v", err)
+	}
+	if _, ok := err.(*UnsupportedError); ok {
+		t.Error("A malformed URI was reported as unsupported, rather than failing")
+	}
+}
@@ -0,0 +1,115 @@
+package authy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterReserve(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newRateLimiter(2, 3)
+	l.last = start
+
+	// The burst is available straight away
+	for i := 0; i < 3; i++ {
+		if _, ok := l.reserve(start); !ok {
+			t.Fatalf("Request %d of the burst was delayed", i+1)
+		}
+	}
+	// Then a token is added every half a second
+	if delay, ok := l.reserve(start); ok || delay != 500*time.Millisecond {
+		t.Errorf("Got delay %v (ok %t), expected 500ms", delay, ok)
+	}
+	if delay, ok := l.reserve(start.Add(200 * time.Millisecond)); ok || delay != 300*time.Millisecond {
+		t.Errorf("Got delay %v (ok %t), expected 300ms", delay, ok)
+	}
+	if _, ok := l.reserve(start.Add(500 * time.Millisecond)); !ok {
+		t.Error("The request was delayed once a token was added")
+	}
+
+	// Idle time fills the bucket no further than the burst
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, ok := l.reserve(later); !ok {
+			t.Fatalf("Request %d of the burst was delayed after idling", i+1)
+		}
+	}
+	if _, ok := l.reserve(later); ok {
+		t.Error("More than the burst was allowed after idling")
+	}
+
+	// A clock that goes backwards doesn't take tokens away
+	if delay, ok := l.reserve(later.Add(-time.Minute)); ok || delay != 500*time.Millisecond {
+		t.Errorf("Got delay %v (ok %t) from an earlier time, expected 500ms", delay, ok)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	if l := newRateLimiter(0, 5); l != nil {
+		t.Error("A rate of zero should disable the limit")
+	}
+	var l *rateLimiter
+	if err := l.wait(context.Background()); err != nil {
+		t.Errorf("An unlimited wait failed: %v", err)
+	}
+}
+
+func TestRateLimiterWaitCancelled(t *testing.T) {
+	l := newRateLimiter(0.001, 1)
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the wait to be cancelled, got %v", err)
+	}
+}
+
+func TestClientIsUnlimitedByDefault(t *testing.T) {
+	cl, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cl.limiter != nil {
+		t.Error("A Client is rate limited without WithRateLimit")
+	}
+}
+
+// Run with -race to check the Client's shared state.
+func TestClientConcurrentUse(t *testing.T) {
+	var requests int32
+	cl, err := NewClient(WithRateLimit(1000, 10), WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&requests, 1)
+		return dateResponse(time.Now()), nil
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cl.QueryAuthenticatorApps(context.Background(), 1, 2, "0123456789abcdef"); err != nil {
+				t.Error(err)
+			}
+			cl.ClockSkew()
+		}()
+	}
+	wg.Wait()
+
+	// Each call syncs the clock unless another already has, and then
+	// fetches the apps
+	if n := atomic.LoadInt32(&requests); n < 21 || n > 40 {
+		t.Errorf("Sent %d requests, expected between 21 and 40", n)
+	}
+	if _, measured := cl.ClockSkew(); !measured {
+		t.Error("The clock skew wasn't measured")
+	}
+}
@@ -0,0 +1,136 @@
+package authy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RotateBackupPassword re-encrypts all of the user's TOTP tokens, which are
+// encrypted with oldPassphrase, with newPassphrase and fresh salts and IVs.
+//
+// Every token is decrypted before any are uploaded, so a token that
+// oldPassphrase can't decrypt aborts the rotation without changes. The API
+// has no transactions, so if an upload fails, the tokens already uploaded
+// are restored to their original encryption. Finally, the tokens are
+// re-downloaded to verify that they decrypt with newPassphrase, and if any
+// don't, all tokens are restored. The error names any tokens which could
+// not be restored.
+//
+// Seeds are re-encrypted as they are, even legacy ones which Encrypt would
+// reject. Deleted tokens can't be updated, so they remain encrypted with
+// oldPassphrase.
+func RotateBackupPassword(ctx context.Context, api API, userID uint64, deviceID uint64, deviceSeed string,
+	oldPassphrase, newPassphrase string) error {
+	resp, err := api.QueryAuthenticatorTokens(ctx, userID, deviceID, deviceSeed)
+	if err != nil {
+		return fmt.Errorf("Could not fetch authenticator tokens: %v", err)
+	}
+	if !resp.Success {
+		return fmt.Errorf("Failed to fetch authenticator tokens: %s", resp.Message)
+	}
+	originals := resp.AuthenticatorTokens
+
+	passwordTimestamp := uint64(time.Now().Unix())
+	seeds := map[string]string{}
+	rotated := make([]AuthenticatorToken, len(originals))
+	for i, tok := range originals {
+		seed, err := tok.Decrypt(oldPassphrase)
+		if err != nil {
+			return fmt.Errorf("Failed to decrypt token %s, nothing was changed: %v", tok.Description(), err)
+		}
+		seeds[tok.UniqueID] = seed
+
+		rotated[i] = tok
+		rotated[i].PasswordTimestamp = passwordTimestamp
+		if err := rotated[i].encryptSeed(strings.ToLower(canonicalSeed(seed)), newPassphrase); err != nil {
+			return fmt.Errorf("Failed to encrypt token %s, nothing was changed: %v", tok.Description(), err)
+		}
+	}
+
+	for i, tok := range rotated {
+		err := updateToken(ctx, api, userID, deviceID, deviceSeed, tok)
+		if err == nil {
+			continue
+		}
+		// Put back the tokens which were already uploaded
+		if failed := restoreTokens(ctx, api, userID, deviceID, deviceSeed, originals[:i]); len(failed) > 0 {
+			return fmt.Errorf("Failed to upload token %s: %v. These tokens could not be rolled back, "+
+				"and are now encrypted with the new password: %s", tok.Description(), err, strings.Join(failed, ", "))
+		}
+		return fmt.Errorf("Failed to upload token %s, nothing was changed: %v", tok.Description(), err)
+	}
+
+	bad, err := verifyTokens(ctx, api, userID, deviceID, deviceSeed, originals, seeds, newPassphrase)
+	if err != nil {
+		return fmt.Errorf("All tokens were uploaded, but could not be verified, so check that they "+
+			"decrypt with the new password: %v", err)
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	failed := restoreTokens(ctx, api, userID, deviceID, deviceSeed, originals)
+	if len(failed) == 0 {
+		return fmt.Errorf("These tokens did not decrypt correctly with the new password, so all tokens "+
+			"were restored to the old password: %s", strings.Join(bad, ", "))
+	}
+	return fmt.Errorf("These tokens did not decrypt correctly with the new password: %s. "+
+		"The other tokens were restored to the old password, but these could not be: %s. "+
+		"Check which password they decrypt with, and if neither, delete them and add them again "+
+		"from their setup keys", strings.Join(bad, ", "), strings.Join(failed, ", "))
+}
+
+// restoreTokens uploads the original tokens, and returns the descriptions
+// of those which failed.
+func restoreTokens(ctx context.Context, api API, userID uint64, deviceID uint64, deviceSeed string,
+	originals []AuthenticatorToken) []string {
+	var failed []string
+	for _, orig := range originals {
+		if updateToken(ctx, api, userID, deviceID, deviceSeed, orig) != nil {
+			failed = append(failed, orig.Description())
+		}
+	}
+	return failed
+}
+
+// verifyTokens re-downloads the tokens, and returns the descriptions of the
+// originals which are missing, or don't decrypt to their seeds with
+// passphrase.
+func verifyTokens(ctx context.Context, api API, userID uint64, deviceID uint64, deviceSeed string,
+	originals []AuthenticatorToken, seeds map[string]string, passphrase string) ([]string, error) {
+	resp, err := api.QueryAuthenticatorTokens(ctx, userID, deviceID, deviceSeed)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("%s", resp.Message)
+	}
+	uploaded := map[string]AuthenticatorToken{}
+	for _, tok := range resp.AuthenticatorTokens {
+		uploaded[tok.UniqueID] = tok
+	}
+	var bad []string
+	for _, orig := range originals {
+		tok, ok := uploaded[orig.UniqueID]
+		if !ok {
+			bad = append(bad, orig.Description()+" (missing)")
+			continue
+		}
+		if got, err := tok.Decrypt(passphrase); err != nil || got != canonicalSeed(seeds[orig.UniqueID]) {
+			bad = append(bad, orig.Description())
+		}
+	}
+	return bad, nil
+}
+
+func updateToken(ctx context.Context, api API, userID uint64, deviceID uint64, deviceSeed string, tok AuthenticatorToken) error {
+	resp, err := api.UpdateAuthenticatorToken(ctx, userID, deviceID, deviceSeed, tok)
+	if err != nil {
+		return err
+	}
+	if !resp.Success {
+		return fmt.Errorf("%s", resp.Message)
+	}
+	return nil
+}
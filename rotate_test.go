@@ -0,0 +1,164 @@
+package authy_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy"
+	"github.com/alexzorin/authy/authytest"
+)
+
+const (
+	oldPassword = "old password"
+	newPassword = "new password"
+)
+
+// rotationFake returns a Fake with a device, whose user has two tokens, a
+// legacy token with a short seed, and a deleted token, all encrypted with
+// oldPassword. It also returns the seeds of the tokens, by name.
+func rotationFake(t *testing.T) (*authytest.Fake, *authytest.User, *authytest.Device, map[string]string) {
+	f := authytest.NewFake()
+	u := f.AddUser(1, "5551234")
+	d, err := f.AddDevice(u.AuthyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seeds := map[string]string{
+		"GitHub":  "JBSWY3DPEHPK3PXP",
+		"Google":  "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"Legacy":  "MFRGG",
+		"Deleted": "KRUGKIDROVUWG2ZA",
+	}
+	for i, name := range []string{"GitHub", "Google", "Legacy", "Deleted"} {
+		tok := authy.AuthenticatorToken{Name: name, OriginalName: name, UniqueID: string(rune('a' + i)), PasswordTimestamp: 1}
+		if name == "Legacy" {
+			err = tok.EncryptLegacy(strings.ToLower(seeds[name]), oldPassword)
+		} else {
+			err = tok.Encrypt(seeds[name], oldPassword)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "Deleted" {
+			u.DeletedTokens = append(u.DeletedTokens, tok)
+		} else {
+			u.Tokens = append(u.Tokens, tok)
+		}
+	}
+	return f, u, d, seeds
+}
+
+// checkPassword checks that all of the user's tokens decrypt to their seeds
+// with passphrase.
+func checkPassword(t *testing.T, u *authytest.User, seeds map[string]string, passphrase string) {
+	t.Helper()
+	for _, tok := range u.Tokens {
+		if got, err := tok.Decrypt(passphrase); err != nil || got != seeds[tok.Name] {
+			t.Errorf("Token %s decrypted to %q, %v with %q, expected %q", tok.Name, got, err, passphrase, seeds[tok.Name])
+		}
+	}
+}
+
+func TestRotateBackupPassword(t *testing.T) {
+	f, u, d, seeds := rotationFake(t)
+
+	if err := authy.RotateBackupPassword(context.Background(), f, u.AuthyID, d.ID, d.SecretSeed, oldPassword, newPassword); err != nil {
+		t.Fatal(err)
+	}
+	checkPassword(t, u, seeds, newPassword)
+	for _, tok := range u.Tokens {
+		if tok.PasswordTimestamp == 1 {
+			t.Errorf("The password timestamp of token %s wasn't updated", tok.Name)
+		}
+	}
+	if seed, err := u.DeletedTokens[0].Decrypt(oldPassword); err != nil || seed != seeds["Deleted"] {
+		t.Errorf("The deleted token decrypted to %q, %v with the old password", seed, err)
+	}
+}
+
+func TestRotateBackupPasswordWrongPassword(t *testing.T) {
+	f, u, d, seeds := rotationFake(t)
+	f.Intercept = func(method string) error {
+		if method == "UpdateAuthenticatorToken" {
+			t.Error("A token was uploaded")
+		}
+		return nil
+	}
+
+	err := authy.RotateBackupPassword(context.Background(), f, u.AuthyID, d.ID, d.SecretSeed, "wrong password", newPassword)
+	if err == nil || !strings.Contains(err.Error(), "nothing was changed") {
+		t.Errorf("Expected nothing to be changed, got %v", err)
+	}
+	checkPassword(t, u, seeds, oldPassword)
+}
+
+func TestRotateBackupPasswordUploadFailure(t *testing.T) {
+	f, u, d, seeds := rotationFake(t)
+	// Fail the upload of the second token
+	var updates int
+	f.Intercept = func(method string) error {
+		if method == "UpdateAuthenticatorToken" {
+			if updates++; updates == 2 {
+				return errors.New("connection reset")
+			}
+		}
+		return nil
+	}
+
+	err := authy.RotateBackupPassword(context.Background(), f, u.AuthyID, d.ID, d.SecretSeed, oldPassword, newPassword)
+	if err == nil || !strings.Contains(err.Error(), "Google") || !strings.Contains(err.Error(), "nothing was changed") {
+		t.Errorf("Expected the upload of Google to fail without changes, got %v", err)
+	}
+	// The first token was rolled back
+	checkPassword(t, u, seeds, oldPassword)
+}
+
+func TestRotateBackupPasswordRollbackFailure(t *testing.T) {
+	f, u, d, seeds := rotationFake(t)
+	// Fail the upload of the second token, and the rollback of the first
+	var updates int
+	f.Intercept = func(method string) error {
+		if method == "UpdateAuthenticatorToken" {
+			if updates++; updates >= 2 {
+				return errors.New("connection reset")
+			}
+		}
+		return nil
+	}
+
+	err := authy.RotateBackupPassword(context.Background(), f, u.AuthyID, d.ID, d.SecretSeed, oldPassword, newPassword)
+	if err == nil || !strings.Contains(err.Error(), "could not be rolled back") || !strings.Contains(err.Error(), "GitHub") {
+		t.Errorf("Expected GitHub not to be rolled back, got %v", err)
+	}
+	if seed, err := u.Tokens[0].Decrypt(newPassword); err != nil || seed != seeds["GitHub"] {
+		t.Errorf("GitHub decrypted to %q, %v with the new password", seed, err)
+	}
+	if seed, err := u.Tokens[1].Decrypt(oldPassword); err != nil || seed != seeds["Google"] {
+		t.Errorf("Google decrypted to %q, %v with the old password", seed, err)
+	}
+}
+
+func TestRotateBackupPasswordVerificationFailure(t *testing.T) {
+	f, u, d, seeds := rotationFake(t)
+	// Corrupt a token after it's uploaded, before it's verified
+	var queries int
+	f.Intercept = func(method string) error {
+		if method == "QueryAuthenticatorTokens" {
+			if queries++; queries == 2 {
+				u.Tokens[1].EncryptedSeed = u.Tokens[0].EncryptedSeed
+			}
+		}
+		return nil
+	}
+
+	err := authy.RotateBackupPassword(context.Background(), f, u.AuthyID, d.ID, d.SecretSeed, oldPassword, newPassword)
+	if err == nil || !strings.Contains(err.Error(), "Google") || !strings.Contains(err.Error(), "restored to the old password") {
+		t.Errorf("Expected Google to fail verification, and the tokens to be restored, got %v", err)
+	}
+	if strings.Contains(err.Error(), "GitHub") {
+		t.Errorf("Only Google should have failed verification, got %v", err)
+	}
+	checkPassword(t, u, seeds, oldPassword)
+}
@@ -0,0 +1,96 @@
+package authy
+
+import (
+	"bytes"
+	"encoding/base32"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MinSecretBytes is the shortest secret accepted. Anything shorter is
+	// more likely a token decrypted with the wrong password than a real seed.
+	MinSecretBytes = 5
+
+	// WeakSecretBytes is the length below which a secret is flagged as weak.
+	// 80 bits is the least that services commonly issue, though RFC 4226
+	// asks for at least 128.
+	WeakSecretBytes = 10
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// InvalidSecretError is returned when a secret isn't valid, to tell it apart
+// from failing to decrypt one.
+type InvalidSecretError struct {
+	Reason string
+}
+
+func (e *InvalidSecretError) Error() string {
+	return e.Reason
+}
+
+// NormalizeSecret returns a base32 secret in canonical form: uppercase,
+// without whitespace or padding. It fails with an InvalidSecretError if the
+// secret can't be decoded, or is shorter than MinSecretBytes.
+func NormalizeSecret(secret string) (string, error) {
+	_, canonical, err := decodeSecret(secret)
+	return canonical, err
+}
+
+// DecodeSecret returns the raw bytes of a base32 secret, normalized as by
+// NormalizeSecret.
+func DecodeSecret(secret string) ([]byte, error) {
+	raw, _, err := decodeSecret(secret)
+	return raw, err
+}
+
+func decodeSecret(secret string) ([]byte, string, error) {
+	canonical := canonicalSeed(secret)
+	if canonical == "" {
+		return nil, "", &InvalidSecretError{"The secret is empty"}
+	}
+	raw, err := secretEncoding.DecodeString(canonical)
+	if err != nil {
+		return nil, "", &InvalidSecretError{"The secret is not valid base32"}
+	}
+	if len(raw) < MinSecretBytes {
+		return nil, "", &InvalidSecretError{fmt.Sprintf("The secret is only %d bytes long", len(raw))}
+	}
+	return raw, canonical, nil
+}
+
+// SecretWeakness returns why a decoded secret is suspicious, or an empty
+// string if it isn't. Secrets shorter than WeakSecretBytes, and those made
+// of a single repeated byte or a repeated short pattern, are flagged.
+func SecretWeakness(secret []byte) string {
+	if len(secret) < WeakSecretBytes {
+		return fmt.Sprintf("it is only %d bits long", len(secret)*8)
+	}
+	for n := 1; n <= 4 && n < len(secret); n++ {
+		if repeats(secret, n) {
+			return "it is a repeated pattern"
+		}
+	}
+	return ""
+}
+
+// repeats reports whether b consists of its first n bytes repeated.
+func repeats(b []byte, n int) bool {
+	for i := n; i < len(b); i += n {
+		end := i + n
+		if end > len(b) {
+			end = len(b)
+		}
+		if !bytes.Equal(b[i:end], b[:end-i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalSeed strips the whitespace and padding from a base32 seed, and
+// uppercases it.
+func canonicalSeed(seed string) string {
+	return strings.ToUpper(strings.TrimRight(strings.Join(strings.Fields(seed), ""), "="))
+}
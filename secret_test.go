@@ -0,0 +1,118 @@
+package authy
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNormalizeSecretInvalid(t *testing.T) {
+	for _, secret := range []string{"", "not base32!", "MFRGG"} {
+		if _, err := NormalizeSecret(secret); err == nil {
+			t.Errorf("%q was accepted", secret)
+		} else if _, ok := err.(*InvalidSecretError); !ok {
+			t.Errorf("%q: expected an InvalidSecretError, got %T: %v", secret, err, err)
+		}
+	}
+	if got, err := NormalizeSecret("jbsw y3dp ehpk 3pxp===="); err != nil || got != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Got %q, %v", got, err)
+	}
+}
+
+func TestNewTokenAccountErrors(t *testing.T) {
+	tok := AuthenticatorToken{Name: "Short", UniqueID: "a", Digits: 6}
+	if err := tok.EncryptLegacy("mfrgg", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The token decrypts, but its secret is too short
+	a, err := NewTokenAccount(tok, "hunter2", nil)
+	if _, ok := err.(*InvalidSecretError); !ok {
+		t.Errorf("Expected an InvalidSecretError, got %T: %v", err, err)
+	}
+	if a.Secret != "" || a.Name != "Short" {
+		t.Errorf("Unexpected account %+v", a)
+	}
+
+	// The token can't be decrypted at all
+	if _, err = NewTokenAccount(tok, "wrong", nil); err == nil {
+		t.Error("The token was decrypted with the wrong password")
+	} else if _, ok := err.(*InvalidSecretError); ok {
+		t.Errorf("A decryption failure was reported as an invalid secret: %v", err)
+	}
+}
+
+func TestDecryptWrongPasswordValidPadding(t *testing.T) {
+	tok := AuthenticatorToken{
+		KDFRounds:     1000,
+		Salt:          "0123456789abcdef",
+		UniqueIV:      "000102030405060708090a0b0c0d0e0f",
+		EncryptedSeed: "RREibDC+wLxmW7BA/NHdUU1sxdBvZRre6bVmjR9jM2g=",
+	}
+	if seed, err := tok.Decrypt("hunter2"); err != nil || seed != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("The token decrypted to %q, %v", seed, err)
+	}
+	// This password happens to leave valid padding, but not a seed
+	if seed, err := tok.Decrypt("wrongdra"); err == nil {
+		t.Errorf("The token decrypted with the wrong password to %q", seed)
+	}
+}
+
+func TestDecodeSecret(t *testing.T) {
+	hello := []byte("Hello!\xde\xad\xbe\xef")
+	tests := map[string][]byte{
+		"JBSWY3DPEHPK3PXP":         hello,
+		"jbswy3dpehpk3pxp":         hello,
+		"JBSW Y3DP EHPK 3PXP":      hello,
+		" jbsw\ty3dp\nehpk3pxp ":   hello,
+		"JBSWY3DPEHPK3PXP========": hello,
+		// Secrets whose length isn't a multiple of 8 characters are padded
+		"MFRGGZA":          []byte("abcd"),
+		"MFRGGZDF":         []byte("abcde"),
+		"MFRGGZDFMY":       []byte("abcdef"),
+		"mfrggzdfmy======": []byte("abcdef"),
+	}
+	for secret, expected := range tests {
+		got, err := DecodeSecret(secret)
+		if len(expected) < MinSecretBytes {
+			if _, ok := err.(*InvalidSecretError); !ok {
+				t.Errorf("DecodeSecret(%q): expected an InvalidSecretError, got %v", secret, err)
+			}
+			continue
+		}
+		if err != nil || !bytes.Equal(got, expected) {
+			t.Errorf("DecodeSecret(%q) = %q, %v, expected %q", secret, got, err, expected)
+		}
+	}
+
+	for _, secret := range []string{"", "  ", "====", "JBSWY3DP1", "JBSW=Y3DP"} {
+		if _, err := DecodeSecret(secret); err == nil {
+			t.Errorf("DecodeSecret(%q) succeeded", secret)
+		}
+	}
+}
+
+func TestSecretWeakness(t *testing.T) {
+	tests := []struct {
+		secret   []byte
+		expected string
+	}{
+		{[]byte("Hello!\xde\xad\xbe\xef"), ""},
+		{[]byte("abcdefghijklmnopqrst"), ""},
+		// Too short
+		{[]byte("abcde"), "it is only 40 bits long"},
+		{[]byte("abcdefghi"), "it is only 72 bits long"},
+		// Repeated patterns of up to 4 bytes, even when cut short
+		{bytes.Repeat([]byte{0}, 20), "it is a repeated pattern"},
+		{bytes.Repeat([]byte("ab"), 10), "it is a repeated pattern"},
+		{[]byte("abcabcabcab"), "it is a repeated pattern"},
+		{bytes.Repeat([]byte("abcd"), 5), "it is a repeated pattern"},
+		// Longer patterns are let through
+		{bytes.Repeat([]byte("abcde"), 4), ""},
+		{append(bytes.Repeat([]byte("ab"), 9), 'c'), ""},
+	}
+	for _, tc := range tests {
+		if got := SecretWeakness(tc.secret); got != tc.expected {
+			t.Errorf("SecretWeakness(%q) = %q, expected %q", tc.secret, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package authy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// AddAuthenticatorToken uploads a new TOTP token for userID, authenticating
+// using the deviceSeed (hex-encoded). The token must already be encrypted
+// with the user's backup password (see AuthenticatorToken.Encrypt), and its
+// KDFRounds and PasswordTimestamp should match the user's existing tokens.
+func (c *Client) AddAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	tok AuthenticatorToken) (AuthenticatorTokenResponse, error) {
+	if tok.EncryptedSeed == "" {
+		return AuthenticatorTokenResponse{}, fmt.Errorf("Token %s is not encrypted", tok.Description())
+	}
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
+	if err != nil {
+		return AuthenticatorTokenResponse{}, err
+	}
+	setTokenForm(form, tok)
+
+	var resp AuthenticatorTokenResponse
+	return resp, c.doRequest(ctx, http.MethodPost,
+		fmt.Sprintf("users/%d/authenticator_tokens", userID), strings.NewReader(form.Encode()), &resp)
+}
+
+// setTokenForm sets the fields of tok which are uploaded to Authy.
+func setTokenForm(form url.Values, tok AuthenticatorToken) {
+	form.Set("name", tok.Name)
+	form.Set("account_type", tok.AccountType)
+	form.Set("digits", strconv.Itoa(tok.Digits))
+	form.Set("encrypted_seed", tok.EncryptedSeed)
+	form.Set("salt", tok.Salt)
+	form.Set("unique_iv", tok.UniqueIV)
+	form.Set("key_derivation_iterations", strconv.Itoa(tok.KDFRounds))
+	form.Set("password_timestamp", strconv.FormatUint(tok.PasswordTimestamp, 10))
+}
+
+// UpdateAuthenticatorToken replaces the stored fields of the token with the
+// same UniqueID as tok, e.g. to rename it or change its AccountType,
+// authenticating using the deviceSeed (hex-encoded).
+func (c *Client) UpdateAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	tok AuthenticatorToken) (AuthenticatorTokenResponse, error) {
+	if tok.UniqueID == "" {
+		return AuthenticatorTokenResponse{}, fmt.Errorf("Token %s has no ID", tok.Description())
+	}
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
+	if err != nil {
+		return AuthenticatorTokenResponse{}, err
+	}
+	setTokenForm(form, tok)
+
+	var resp AuthenticatorTokenResponse
+	return resp, c.doRequest(ctx, http.MethodPut,
+		fmt.Sprintf("users/%d/authenticator_tokens/%s", userID, url.PathEscape(tok.UniqueID)),
+		strings.NewReader(form.Encode()), &resp)
+}
+
+// DeleteAuthenticatorToken deletes the token with uniqueID. Authy retains
+// deleted tokens for a while, during which they are listed in
+// AuthenticatorTokensResponse.Deleted and may be restored.
+func (c *Client) DeleteAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	uniqueID string) (SuccessResponse, error) {
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
+	if err != nil {
+		return SuccessResponse{}, err
+	}
+
+	var resp SuccessResponse
+	return resp, c.doRequest(ctx, http.MethodDelete,
+		fmt.Sprintf("users/%d/authenticator_tokens/%s?%s", userID, url.PathEscape(uniqueID), form.Encode()), nil, &resp)
+}
+
+// RestoreAuthenticatorToken restores the deleted token with uniqueID.
+func (c *Client) RestoreAuthenticatorToken(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	uniqueID string) (SuccessResponse, error) {
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
+	if err != nil {
+		return SuccessResponse{}, err
+	}
+
+	var resp SuccessResponse
+	return resp, c.doRequest(ctx, http.MethodPost,
+		fmt.Sprintf("users/%d/authenticator_tokens/%s/restore", userID, url.PathEscape(uniqueID)),
+		strings.NewReader(form.Encode()), &resp)
+}
+
+// RestoreAuthenticatorApp restores the deleted Authy App with appID (see
+// AuthenticatorApp.ID).
+func (c *Client) RestoreAuthenticatorApp(ctx context.Context, userID uint64, deviceID uint64, deviceSeed string,
+	appID string) (SuccessResponse, error) {
+	form, err := c.deviceForm(ctx, deviceID, deviceSeed)
+	if err != nil {
+		return SuccessResponse{}, err
+	}
+
+	var resp SuccessResponse
+	return resp, c.doRequest(ctx, http.MethodPost,
+		fmt.Sprintf("users/%d/devices/%d/apps/%s/restore", userID, deviceID, url.PathEscape(appID)),
+		strings.NewReader(form.Encode()), &resp)
+}
@@ -0,0 +1,124 @@
+package twofas
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/alexzorin/authy/otpauth"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Read reads the keys of a 2FAS backup, with their group as their tag. The
+// password is only needed if the backup is encrypted. Services of
+// unsupported types are left out, and reported with an
+// otpauth.UnsupportedError.
+func Read(r io.Reader, password string) ([]otpauth.Key, error) {
+	var b Backup
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, fmt.Errorf("Failed to decode the backup: %v", err)
+	}
+
+	if b.ServicesEncrypted != "" {
+		if password == "" {
+			return nil, otpauth.ErrPasswordRequired
+		}
+		plain, err := decrypt(b.ServicesEncrypted, password)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(plain, &b.Services); err != nil {
+			return nil, fmt.Errorf("Failed to decode the backup's services: %v", err)
+		}
+	}
+
+	groups := map[string]string{}
+	for _, g := range b.Groups {
+		groups[g.ID] = g.Name
+	}
+	sort.SliceStable(b.Services, func(i, j int) bool {
+		return b.Services[i].Order.Position < b.Services[j].Order.Position
+	})
+
+	var keys []otpauth.Key
+	var skipped []string
+	for _, s := range b.Services {
+		account := s.OTP.Account
+		if account == "" {
+			account = s.OTP.Label
+		}
+		issuer := s.OTP.Issuer
+		if issuer == "" {
+			issuer = s.Name
+		}
+		k := otpauth.New(issuer, account, s.Secret)
+		switch strings.ToUpper(s.OTP.TokenType) {
+		case "", "TOTP":
+		case "HOTP":
+			k.Type = otpauth.TypeHOTP
+			k.Counter = s.OTP.Counter
+		case "STEAM":
+			k.Type = otpauth.TypeSteam
+		default:
+			skipped = append(skipped, fmt.Sprintf("%s (%s key)", k.Label(), s.OTP.TokenType))
+			continue
+		}
+		if s.OTP.Algorithm != "" {
+			k.Algorithm = strings.ToUpper(s.OTP.Algorithm)
+		}
+		if s.OTP.Digits != 0 {
+			k.Digits = s.OTP.Digits
+		}
+		if s.OTP.Period != 0 {
+			k.Period = s.OTP.Period
+		}
+		if s.GroupID != nil {
+			if name, ok := groups[*s.GroupID]; ok {
+				k.Tags = []string{name}
+			}
+		}
+		keys = append(keys, k)
+	}
+	if len(skipped) > 0 {
+		return keys, &otpauth.UnsupportedError{Skipped: skipped}
+	}
+	return keys, nil
+}
+
+// decrypt decrypts "ciphertext:salt:iv", as written by encrypt.
+func decrypt(encoded, password string) ([]byte, error) {
+	parts := strings.Split(encoded, ":")
+	if len(parts) != 3 {
+		return nil, errors.New("The encrypted services are malformed")
+	}
+	var decoded [3][]byte
+	for i, p := range parts {
+		var err error
+		if decoded[i], err = base64.StdEncoding.DecodeString(p); err != nil {
+			return nil, fmt.Errorf("The encrypted services are malformed: %v", err)
+		}
+	}
+	ct, salt, iv := decoded[0], decoded[1], decoded[2]
+
+	key := pbkdf2.Key([]byte(password), salt, kdfIterations, 32, sha256.New)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, iv, ct, nil)
+	if err != nil {
+		return nil, errors.New("The password doesn't decrypt the backup")
+	}
+	return plain, nil
+}
@@ -0,0 +1,54 @@
+package twofas
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+func TestRead(t *testing.T) {
+	f, err := os.Open("testdata/backup.2fas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	keys, err := Read(f, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Services are in the order of their positions
+	expected := []struct {
+		uri  string
+		tags string
+	}{
+		{"otpauth://totp/GitHub:alice?digits=6&issuer=GitHub&secret=JBSWY3DPEHPK3PXP", "Work"},
+		{"otpauth://hotp/Google:bob@example.com?counter=7&digits=6&issuer=Google&secret=GEZDGNBVGY3TQOJQ", ""},
+		{"otpauth://steam/Steam:carol?digits=5&issuer=Steam&secret=KRUGKIDROVUWG2ZA", ""},
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Got %d keys, expected %d", len(keys), len(expected))
+	}
+	for i, k := range keys {
+		if k.URI() != expected[i].uri || strings.Join(k.Tags, ",") != expected[i].tags {
+			t.Errorf("Key %d: got %s tagged %v, expected %s tagged %q", i, k.URI(), k.Tags, expected[i].uri, expected[i].tags)
+		}
+	}
+}
+
+func TestReadSkipsUnsupported(t *testing.T) {
+	backup := `{"services":[
+		{"name":"GitHub","secret":"JBSWY3DPEHPK3PXP","otp":{"account":"alice","digits":6,"period":30,"algorithm":"SHA1","tokenType":"TOTP"},"order":{"position":0}},
+		{"name":"Example","secret":"MFRGGZDFMZTWQ2LK","otp":{"account":"dave","digits":6,"period":30,"algorithm":"SHA1","tokenType":"YANDEX"},"order":{"position":1}}
+	],"groups":[],"schemaVersion":4}`
+	keys, err := Read(strings.NewReader(backup), "")
+	uerr, ok := err.(*otpauth.UnsupportedError)
+	if !ok || len(uerr.Skipped) != 1 || !strings.Contains(uerr.Skipped[0], "Example:dave (YANDEX key)") {
+		t.Errorf("Expected the YANDEX service to be skipped, got %v", err)
+	}
+	if len(keys) != 1 || keys[0].Issuer != "GitHub" {
+		t.Errorf("Expected the GitHub key to be read, got %+v", keys)
+	}
+}
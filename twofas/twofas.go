@@ -0,0 +1,244 @@
+// Package twofas reads and writes backups of the 2FAS Authenticator (.2fas
+// files), optionally encrypted with a password.
+package twofas
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The backup schema version that is written
+const SchemaVersion = 4
+
+// Backup is a 2FAS backup. If it is encrypted, its services are in
+// ServicesEncrypted instead of Services.
+type Backup struct {
+	Services          []Service `json:"services"`
+	Groups            []Group   `json:"groups"`
+	UpdatedAt         int64     `json:"updatedAt"`
+	SchemaVersion     int       `json:"schemaVersion"`
+	AppVersionCode    int       `json:"appVersionCode"`
+	AppVersionName    string    `json:"appVersionName"`
+	AppOrigin         string    `json:"appOrigin"`
+	ServicesEncrypted string    `json:"servicesEncrypted,omitempty"`
+	Reference         string    `json:"reference,omitempty"`
+}
+
+// Service is an account in 2FAS.
+type Service struct {
+	Name      string  `json:"name"`
+	Secret    string  `json:"secret"`
+	UpdatedAt int64   `json:"updatedAt"`
+	OTP       OTP     `json:"otp"`
+	Order     Order   `json:"order"`
+	Icon      *Icon   `json:"icon,omitempty"`
+	GroupID   *string `json:"groupId"`
+}
+
+// OTP describes how a service's codes are generated.
+type OTP struct {
+	Label     string `json:"label,omitempty"`
+	Account   string `json:"account"`
+	Issuer    string `json:"issuer,omitempty"`
+	Digits    int    `json:"digits"`
+	Period    int    `json:"period"`
+	Counter   uint64 `json:"counter,omitempty"`
+	Algorithm string `json:"algorithm"`
+	TokenType string `json:"tokenType"`
+	Source    string `json:"source"`
+}
+
+// Order is the position of a service in the list.
+type Order struct {
+	Position int `json:"position"`
+}
+
+// Icon is the icon of a service. Services are given a text label, and 2FAS
+// picks a brand icon from the issuer.
+type Icon struct {
+	Selected       string         `json:"selected"`
+	Label          IconLabel      `json:"label"`
+	IconCollection IconCollection `json:"iconCollection"`
+}
+
+// IconLabel is the text shown in place of a brand icon.
+type IconLabel struct {
+	Text            string `json:"text"`
+	BackgroundColor string `json:"backgroundColor"`
+}
+
+// IconCollection identifies a brand icon.
+type IconCollection struct {
+	ID string `json:"id"`
+}
+
+// Group is a group of services.
+type Group struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	IsExpanded bool   `json:"isExpanded"`
+	UpdatedAt  int64  `json:"updatedAt"`
+}
+
+// NewGroup returns a new, expanded group.
+func NewGroup(name string) (Group, error) {
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return Group{}, err
+	}
+	buf[6] = buf[6]&0x0f | 0x40
+	buf[8] = buf[8]&0x3f | 0x80
+	return Group{
+		ID:         fmt.Sprintf("%x-%x-%x-%x-%x", buf[0:4], buf[4:6], buf[6:8], buf[8:10], buf[10:16]),
+		Name:       name,
+		IsExpanded: true,
+		UpdatedAt:  millis(time.Now()),
+	}, nil
+}
+
+// The digits, periods and algorithms that 2FAS supports.
+var (
+	supportedDigits     = map[int]bool{6: true, 7: true, 8: true}
+	supportedPeriods    = map[int]bool{30: true, 60: true, 90: true}
+	supportedAlgorithms = map[string]bool{"SHA1": true, "SHA224": true, "SHA256": true, "SHA384": true, "SHA512": true}
+)
+
+// The icon collection which 2FAS uses for services without a brand icon
+const defaultIconCollection = "a5b3fb65-4ec5-43e6-8ec1-49e24ca9e7ad"
+
+// NewService returns a TOTP service with a text icon. The OTP must be one
+// that 2FAS supports, otherwise an error describes why not.
+func NewService(name, secret string, otp OTP) (Service, error) {
+	var problems []string
+	if !supportedDigits[otp.Digits] {
+		problems = append(problems, fmt.Sprintf("%d digits", otp.Digits))
+	}
+	if !supportedPeriods[otp.Period] {
+		problems = append(problems, fmt.Sprintf("a period of %d seconds", otp.Period))
+	}
+	if !supportedAlgorithms[otp.Algorithm] {
+		problems = append(problems, fmt.Sprintf("the %s algorithm", otp.Algorithm))
+	}
+	if len(problems) > 0 {
+		return Service{}, fmt.Errorf("2FAS does not support %s", strings.Join(problems, " or "))
+	}
+
+	otp.TokenType = "TOTP"
+	if otp.Source == "" {
+		otp.Source = "Link"
+	}
+	text := []rune(strings.ToUpper(strings.Join(strings.Fields(name), "")))
+	if len(text) > 2 {
+		text = text[:2]
+	}
+	return Service{
+		Name:      name,
+		Secret:    strings.ToUpper(secret),
+		UpdatedAt: millis(time.Now()),
+		OTP:       otp,
+		Icon: &Icon{
+			Selected:       "Label",
+			Label:          IconLabel{Text: string(text), BackgroundColor: "Default"},
+			IconCollection: IconCollection{ID: defaultIconCollection},
+		},
+	}, nil
+}
+
+// NewBackup returns a backup of the services, ordered as they are given.
+func NewBackup(services []Service, groups []Group) *Backup {
+	for i := range services {
+		services[i].Order.Position = i
+	}
+	if services == nil {
+		services = []Service{}
+	}
+	if groups == nil {
+		groups = []Group{}
+	}
+	return &Backup{
+		Services:       services,
+		Groups:         groups,
+		UpdatedAt:      millis(time.Now()),
+		SchemaVersion:  SchemaVersion,
+		AppVersionCode: 5000000,
+		AppVersionName: "5.0.0",
+		AppOrigin:      "android",
+	}
+}
+
+// Write writes the backup as a plain .2fas file.
+func (b *Backup) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc.Encode(b)
+}
+
+// Key derivation of encrypted backups
+const (
+	kdfIterations = 10000
+	saltSize      = 256
+)
+
+// reference is encrypted alongside the services, for 2FAS to check the
+// password against when importing.
+const reference = "tRViSsLKzd86Hprh4ceC2OP7xazn4rrt4xhfEUbOjxLX8Rc3mkISXE0lWbmnWfggogbBJhtYgpK6fMl1D6mtsy92R3HkdGfwuXbzLebqVFJsR7IZ2w58t938iymwG4824igYy1wi6n2WDpO1Q1P69zwJGs2F5a1qP4MyIiDSD7NCV2OvidXQCBnDlGfmz0f1BQySRkkt4ryiJeCjD2o4QsveJ9uDBUn8ELyOrESv5R5DMDkD4iAF8TXU7KyoJujd"
+
+// WriteEncrypted writes the backup with its services encrypted with a key
+// derived from password, as 2FAS does when a backup password is set.
+func (b *Backup) WriteEncrypted(w io.Writer, password string) error {
+	services, err := json.Marshal(b.Services)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return err
+	}
+	key := pbkdf2.Key([]byte(password), salt, kdfIterations, 32, sha256.New)
+
+	out := *b
+	out.Services = []Service{}
+	if out.ServicesEncrypted, err = encrypt(key, salt, services); err != nil {
+		return err
+	}
+	if out.Reference, err = encrypt(key, salt, []byte(reference)); err != nil {
+		return err
+	}
+	return out.Write(w)
+}
+
+// encrypt encrypts plaintext with AES-GCM, encoded as
+// "ciphertext:salt:iv", each in base64.
+func encrypt(key, salt, plaintext []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return "", err
+	}
+	ct := gcm.Seal(nil, iv, plaintext, nil)
+
+	b64 := base64.StdEncoding.EncodeToString
+	return b64(ct) + ":" + b64(salt) + ":" + b64(iv), nil
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,96 @@
+package twofas
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alexzorin/authy/otpauth"
+)
+
+func testBackup(t *testing.T) *Backup {
+	group, err := NewGroup("Work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	github, err := NewService("GitHub", "jbswy3dpehpk3pxp", OTP{Account: "alice", Issuer: "GitHub", Digits: 6, Period: 30, Algorithm: "SHA1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	github.GroupID = &group.ID
+	google, err := NewService("Google", "GEZDGNBVGY3TQOJQ", OTP{Account: "bob@example.com", Digits: 8, Period: 60, Algorithm: "SHA256"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewBackup([]Service{github, google}, []Group{group})
+}
+
+func TestWriteEncryptedRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := testBackup(t).WriteEncrypted(&buf, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "JBSWY3DPEHPK3PXP") || strings.Contains(buf.String(), "alice") {
+		t.Fatal("The services were written in the clear")
+	}
+	var b Backup
+	if err := json.Unmarshal(buf.Bytes(), &b); err != nil {
+		t.Fatal(err)
+	}
+	if len(b.Services) != 0 || b.ServicesEncrypted == "" || b.Reference == "" {
+		t.Fatalf("Expected only encrypted services, got %+v", b)
+	}
+	if ref, err := decrypt(b.Reference, "hunter2"); err != nil || string(ref) != reference {
+		t.Errorf("The reference decrypted to %q, %v", ref, err)
+	}
+
+	keys, err := Read(bytes.NewReader(buf.Bytes()), "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []otpauth.Key{
+		{Type: otpauth.TypeTOTP, Issuer: "GitHub", Account: "alice", Secret: "JBSWY3DPEHPK3PXP",
+			Algorithm: "SHA1", Digits: 6, Period: 30, Tags: []string{"Work"}},
+		{Type: otpauth.TypeTOTP, Issuer: "Google", Account: "bob@example.com", Secret: "GEZDGNBVGY3TQOJQ",
+			Algorithm: "SHA256", Digits: 8, Period: 60},
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Got %d keys, expected %d: %+v", len(keys), len(expected), keys)
+	}
+	for i := range expected {
+		got, want := keys[i], expected[i]
+		if got.Type != want.Type || got.Issuer != want.Issuer || got.Account != want.Account ||
+			got.Secret != want.Secret || got.Algorithm != want.Algorithm || got.Digits != want.Digits ||
+			got.Period != want.Period || strings.Join(got.Tags, ",") != strings.Join(want.Tags, ",") {
+			t.Errorf("Key %d: got %+v, expected %+v", i, got, want)
+		}
+	}
+
+	if _, err := Read(bytes.NewReader(buf.Bytes()), "wrong"); err == nil || !strings.Contains(err.Error(), "password") {
+		t.Errorf("Expected the wrong password to be rejected, got %v", err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes()), ""); err != otpauth.ErrPasswordRequired {
+		t.Errorf("Expected a password to be required, got %v", err)
+	}
+}
+
+func TestWriteEncryptedUsesFreshSalts(t *testing.T) {
+	var a, b bytes.Buffer
+	backup := testBackup(t)
+	if err := backup.WriteEncrypted(&a, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := backup.WriteEncrypted(&b, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	var ba, bb Backup
+	json.Unmarshal(a.Bytes(), &ba)
+	json.Unmarshal(b.Bytes(), &bb)
+	if ba.ServicesEncrypted == bb.ServicesEncrypted {
+		t.Error("The same backup was encrypted identically twice")
+	}
+	if len(backup.Services) != 2 || backup.ServicesEncrypted != "" {
+		t.Error("Encrypting the backup modified it")
+	}
+}